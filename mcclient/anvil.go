@@ -0,0 +1,456 @@
+package mcclient
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"encoding/binary"
+	"fmt"
+	"github.com/kierdavis/mc/nbt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const regionSectorSize = 4096
+
+// Chunk compression schemes used in region files.
+const (
+	compressionGzip = 1
+	compressionZlib = 2
+)
+
+type RegionCoord struct {
+	X int
+	Z int
+}
+
+// Returns the region containing a column.
+func (coord ColumnCoord) Region() (region RegionCoord) {
+	return RegionCoord{coord.X >> 5, coord.Z >> 5}
+}
+
+// Returns the filename of a region file, e.g. "r.-1.2.mca".
+func (region RegionCoord) Filename() (filename string) {
+	return fmt.Sprintf("r.%d.%d.mca", region.X, region.Z)
+}
+
+// Writes every stored column to Anvil region files in dir (normally the "region"
+// directory of a world save), creating it if necessary. Columns already present in
+// existing region files are kept unless a stored column replaces them.
+func (client *Client) SaveRegions(dir string) (err error) {
+	regions := make(map[RegionCoord]map[ColumnCoord]*Column)
+	snapshot := client.World.Snapshot()
+
+	for _, coord := range snapshot.Coords() {
+		column, _ := snapshot.GetColumn(coord)
+		region := coord.Region()
+
+		columns, ok := regions[region]
+		if !ok {
+			columns = make(map[ColumnCoord]*Column)
+			regions[region] = columns
+		}
+
+		columns[coord] = column
+	}
+
+	err = os.MkdirAll(dir, 0755)
+	if err != nil {
+		return err
+	}
+
+	for region, columns := range regions {
+		filename := filepath.Join(dir, region.Filename())
+
+		existing, err := ReadRegionFile(filename)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+
+		for coord, column := range existing {
+			if _, ok := columns[coord]; !ok {
+				columns[coord] = column
+			}
+		}
+
+		err = WriteRegionFile(filename, columns)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Reads every region file in dir into the stored world, replacing any stored columns
+// with the same coordinates. This can be used to analyse a saved world offline, or to
+// give a bot a map of the world before it joins.
+func (client *Client) LoadRegions(dir string) (err error) {
+	filenames, err := filepath.Glob(filepath.Join(dir, "r.*.*.mca"))
+	if err != nil {
+		return err
+	}
+
+	for _, filename := range filenames {
+		columns, err := ReadRegionFile(filename)
+		if err != nil {
+			return err
+		}
+
+		for coord, column := range columns {
+			client.World.SetColumn(coord, column)
+		}
+	}
+
+	return nil
+}
+
+// Reads every chunk in a region file.
+func ReadRegionFile(filename string) (columns map[ColumnCoord]*Column, err error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data) < regionSectorSize*2 {
+		if len(data) == 0 {
+			return make(map[ColumnCoord]*Column), nil
+		}
+
+		return nil, fmt.Errorf("%s: truncated region header", filename)
+	}
+
+	columns = make(map[ColumnCoord]*Column)
+
+	for index := 0; index < 1024; index++ {
+		location := binary.BigEndian.Uint32(data[index*4:])
+		if location == 0 {
+			continue
+		}
+
+		// Some writers do not pad the last chunk to a whole sector, so only the chunk data
+		// itself is checked against the end of the file.
+		offset := int(location>>8) * regionSectorSize
+		size := int(location&0xFF) * regionSectorSize
+
+		if offset < regionSectorSize*2 || offset+5 > len(data) {
+			return nil, fmt.Errorf("%s: chunk %d lies outside the file", filename, index)
+		}
+
+		length := int(binary.BigEndian.Uint32(data[offset:]))
+		if length < 1 || length+4 > size || offset+4+length > len(data) {
+			return nil, fmt.Errorf("%s: chunk %d has a bad length", filename, index)
+		}
+
+		compression := data[offset+4]
+		compressed := bytes.NewReader(data[offset+5 : offset+4+length])
+
+		root, err := decodeChunk(compressed, compression)
+		if err != nil {
+			return nil, fmt.Errorf("%s: chunk %d: %s", filename, index, err.Error())
+		}
+
+		coord, column, err := ColumnFromNBT(root)
+		if err != nil {
+			return nil, fmt.Errorf("%s: chunk %d: %s", filename, index, err.Error())
+		}
+
+		columns[coord] = column
+	}
+
+	return columns, nil
+}
+
+func decodeChunk(r io.Reader, compression byte) (root nbt.Compound, err error) {
+	var dr io.ReadCloser
+
+	switch compression {
+	case compressionGzip:
+		dr, err = gzip.NewReader(r)
+	case compressionZlib:
+		dr, err = zlib.NewReader(r)
+	default:
+		return nil, fmt.Errorf("unknown compression type %d", compression)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer dr.Close()
+
+	_, root, err = nbt.Read(dr)
+	return root, err
+}
+
+// Writes a single column to a gzipped NBT file, in the same format as chunks in region
+// files.
+func writeColumnFile(filename string, coord ColumnCoord, column *Column) (err error) {
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+
+	zw := gzip.NewWriter(f)
+
+	err = nbt.Write(zw, "", ColumnToNBT(coord, column))
+	if err == nil {
+		err = zw.Close()
+	}
+
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
+
+func readColumnFile(filename string) (column *Column, err error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	defer f.Close()
+
+	root, err := decodeChunk(f, compressionGzip)
+	if err != nil {
+		return nil, err
+	}
+
+	_, column, err = ColumnFromNBT(root)
+	return column, err
+}
+
+// Converts the root compound of an Anvil chunk to a column.
+func ColumnFromNBT(root nbt.Compound) (coord ColumnCoord, column *Column, err error) {
+	level, ok := root.Compound("Level")
+	if !ok {
+		return coord, nil, fmt.Errorf("missing Level compound")
+	}
+
+	x, ok1 := level.Int("xPos")
+	z, ok2 := level.Int("zPos")
+	if !ok1 || !ok2 {
+		return coord, nil, fmt.Errorf("missing xPos or zPos")
+	}
+
+	coord = ColumnCoord{int(x), int(z)}
+	column = &Column{Chunks: make(map[int]*Chunk)}
+
+	biomes, ok := level.ByteArray("Biomes")
+	if ok && len(biomes) == 256 {
+		column.Biomes = biomes
+	}
+
+	sections, _ := level.List("Sections")
+
+	for _, elem := range sections.Elems {
+		section, ok := elem.(nbt.Compound)
+		if !ok {
+			return coord, nil, fmt.Errorf("Sections is not a list of compounds")
+		}
+
+		y, ok := section.Byte("Y")
+		if !ok || y < 0 || y >= 16 {
+			return coord, nil, fmt.Errorf("section has a missing or bad Y")
+		}
+
+		chunk := new(Chunk)
+
+		chunk.BlockTypes, err = sectionArray(section, "Blocks", 4096, true)
+		if err == nil {
+			chunk.BlockMetadata, err = sectionArray(section, "Data", 2048, true)
+		}
+		if err == nil {
+			chunk.BlockLight, err = sectionArray(section, "BlockLight", 2048, true)
+		}
+		if err == nil {
+			chunk.SkyLight, err = sectionArray(section, "SkyLight", 2048, true)
+		}
+		if err == nil {
+			chunk.AddTypes, err = sectionArray(section, "Add", 2048, false)
+		}
+		if err != nil {
+			return coord, nil, err
+		}
+
+		chunk = compactChunk(chunk)
+		if chunk != nil {
+			column.Chunks[int(y)] = chunk
+		}
+	}
+
+	return coord, column, nil
+}
+
+func sectionArray(section nbt.Compound, name string, size int, required bool) (data []byte, err error) {
+	data, ok := section.ByteArray(name)
+	if !ok {
+		if required {
+			return nil, fmt.Errorf("section is missing %s", name)
+		}
+
+		return nil, nil
+	}
+
+	if len(data) != size {
+		return nil, fmt.Errorf("section %s has length %d, expected %d", name, len(data), size)
+	}
+
+	return data, nil
+}
+
+// Writes columns to a region file. All of the columns must lie in the same region.
+func WriteRegionFile(filename string, columns map[ColumnCoord]*Column) (err error) {
+	var locations [1024]uint32
+	var timestamps [1024]uint32
+	var data bytes.Buffer
+
+	var region RegionCoord
+	first := true
+	now := uint32(time.Now().Unix())
+
+	for coord, column := range columns {
+		if first {
+			region = coord.Region()
+			first = false
+
+		} else if coord.Region() != region {
+			return fmt.Errorf("Column (%d, %d) is not in region (%d, %d)", coord.X, coord.Z, region.X, region.Z)
+		}
+
+		var compressed bytes.Buffer
+
+		zw := zlib.NewWriter(&compressed)
+		err = nbt.Write(zw, "", ColumnToNBT(coord, column))
+		if err != nil {
+			return err
+		}
+
+		err = zw.Close()
+		if err != nil {
+			return err
+		}
+
+		// Each chunk is a 4-byte length, a compression type and the data, padded to a whole
+		// number of sectors.
+		length := compressed.Len() + 1
+		sectors := (length + 4 + regionSectorSize - 1) / regionSectorSize
+		if sectors > 255 {
+			return fmt.Errorf("Column (%d, %d) is too large for a region file", coord.X, coord.Z)
+		}
+
+		offset := 2 + data.Len()/regionSectorSize
+		index := (coord.X & 31) + (coord.Z&31)*32
+		locations[index] = uint32(offset)<<8 | uint32(sectors)
+		timestamps[index] = now
+
+		binary.Write(&data, binary.BigEndian, uint32(length))
+		data.WriteByte(compressionZlib)
+		data.Write(compressed.Bytes())
+		data.Write(make([]byte, sectors*regionSectorSize-length-4))
+	}
+
+	// Write to a temporary file and move it into place, so that a failed write leaves any
+	// existing region file intact.
+	f, err := ioutil.TempFile(filepath.Dir(filename), filepath.Base(filename)+".tmp")
+	if err != nil {
+		return err
+	}
+
+	tmpFilename := f.Name()
+
+	err = f.Chmod(0644)
+	if err == nil {
+		err = binary.Write(f, binary.BigEndian, locations)
+	}
+
+	if err == nil {
+		err = binary.Write(f, binary.BigEndian, timestamps)
+	}
+
+	if err == nil {
+		_, err = f.Write(data.Bytes())
+	}
+
+	if err == nil {
+		err = f.Close()
+	} else {
+		f.Close()
+	}
+
+	if err == nil {
+		err = os.Rename(tmpFilename, filename)
+	}
+
+	if err != nil {
+		os.Remove(tmpFilename)
+		return err
+	}
+
+	return nil
+}
+
+// Converts a column to the root compound of an Anvil chunk.
+func ColumnToNBT(coord ColumnCoord, column *Column) (root nbt.Compound) {
+	sections := nbt.List{ElemType: nbt.TagCompound}
+	heightMap := make([]int32, 256)
+
+	// The height map holds the Y coordinate just above the highest non-air block of each
+	// column of blocks.
+	highest, _ := column.HeightMaps()
+	for i, y := range highest {
+		heightMap[i] = int32(y + 1)
+	}
+
+	for cy := 0; cy < 16; cy++ {
+		chunk, ok := column.Chunks[cy]
+		if !ok {
+			continue
+		}
+
+		section := nbt.Compound{
+			"Y":          int8(cy),
+			"Blocks":     orZeroes(chunk.BlockTypes, 4096),
+			"Data":       orZeroes(chunk.BlockMetadata, 2048),
+			"BlockLight": orZeroes(chunk.BlockLight, 2048),
+			"SkyLight":   orZeroes(chunk.SkyLight, 2048),
+		}
+
+		if chunk.AddTypes != nil {
+			section["Add"] = chunk.AddTypes
+		}
+
+		sections.Elems = append(sections.Elems, section)
+	}
+
+	level := nbt.Compound{
+		"xPos":             int32(coord.X),
+		"zPos":             int32(coord.Z),
+		"LastUpdate":       int64(0),
+		"TerrainPopulated": int8(1),
+		"HeightMap":        heightMap,
+		"Sections":         sections,
+		"Entities":         nbt.List{ElemType: nbt.TagCompound},
+		"TileEntities":     nbt.List{ElemType: nbt.TagCompound},
+	}
+
+	if column.Biomes != nil {
+		level["Biomes"] = column.Biomes
+	}
+
+	return nbt.Compound{"Level": level}
+}
+
+func orZeroes(data []byte, size int) (result []byte) {
+	if data == nil {
+		return make([]byte, size)
+	}
+
+	return data
+}
@@ -0,0 +1,31 @@
+package mcclient
+
+import (
+	"github.com/kierdavis/mc/resources"
+)
+
+// The Biome of blocks in columns without biome data.
+const UnknownBiome = 255
+
+type Block struct {
+	ID         uint16 // The block ID, including the 4 bits from the add types array.
+	Metadata   byte
+	BlockLight byte
+	SkyLight   byte
+	Biome      byte // The biome ID of the block's column, or UnknownBiome.
+}
+
+// Returns the item corresponding to the block, if there is one.
+func (block Block) Item() (item resources.Item, ok bool) {
+	return resources.ItemByIDAndData(block.ID, uint16(block.Metadata))
+}
+
+// Reports whether the block belongs to any of the given categories, e.g.
+// block.Is(resources.Log).
+func (block Block) Is(categories resources.BlockCategory) (is bool) {
+	return resources.BlockIs(block.ID, categories)
+}
+
+func (block Block) IsAir() (is bool) {
+	return block.ID == 0
+}
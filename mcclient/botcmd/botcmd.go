@@ -0,0 +1,296 @@
+// Package botcmd routes commands sent to a bot in chat to handler functions.
+//
+// Players whisper commands to the bot ("/tell Bot chop 10"), or say them in public chat
+// after the router's prefix ("!chop 10"). Replies are whispered back.
+package botcmd
+
+import (
+	"fmt"
+	"github.com/kierdavis/mc/mcclient"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// Runs a command. An error is reported to the player who sent the command.
+type Handler func(ctx *Context) (err error)
+
+type Command struct {
+	Name    string
+	Aliases []string
+	Usage   string // The arguments, e.g. "<count> [radius]".
+	Help    string // A one-line description.
+	MinArgs int
+	MaxArgs int  // -1 for no limit.
+	Public  bool // Whether players not on the allow list may use the command.
+	Handler Handler
+}
+
+// The player who sent a command and its arguments.
+type Context struct {
+	Router  *Router
+	Client  *mcclient.Client
+	Message mcclient.ChatMessage
+	Sender  string
+	Command *Command
+	Args    []string
+}
+
+// Whispers a message to the player who sent the command.
+func (ctx *Context) Reply(format string, args ...interface{}) (err error) {
+	return ctx.Client.Chat(fmt.Sprintf("/tell %s %s", ctx.Sender, fmt.Sprintf(format, args...)))
+}
+
+// Returns an argument as an integer.
+func (ctx *Context) Int(i int) (n int, err error) {
+	n, err = strconv.Atoi(ctx.Args[i])
+	if err != nil {
+		return 0, fmt.Errorf("Argument %d must be a whole number", i+1)
+	}
+
+	return n, nil
+}
+
+// Returns an argument as an integer, or def if it was not given.
+func (ctx *Context) IntOr(i int, def int) (n int, err error) {
+	if i >= len(ctx.Args) {
+		return def, nil
+	}
+
+	return ctx.Int(i)
+}
+
+type Router struct {
+	Client *mcclient.Client
+
+	// Commands said in public chat must start with Prefix; if it is empty, only whispers
+	// are treated as commands.
+	Prefix string
+
+	mutex    sync.Mutex
+	commands map[string]*Command
+	allowed  map[string]bool
+}
+
+// Creates a router with a "help" command.
+func NewRouter(client *mcclient.Client) (router *Router) {
+	router = &Router{
+		Client:   client,
+		commands: make(map[string]*Command),
+		allowed:  make(map[string]bool),
+	}
+
+	router.Register(&Command{
+		Name:    "help",
+		Usage:   "[command]",
+		Help:    "Lists commands, or describes one.",
+		MaxArgs: 1,
+		Public:  true,
+		Handler: router.help,
+	})
+
+	return router
+}
+
+// Adds players to the allow list, who may use every command. Names are not case
+// sensitive.
+func (router *Router) Allow(names ...string) {
+	router.mutex.Lock()
+	defer router.mutex.Unlock()
+
+	for _, name := range names {
+		router.allowed[strings.ToLower(name)] = true
+	}
+}
+
+// Reports whether a player may use a command.
+func (router *Router) Allowed(name string, cmd *Command) (allowed bool) {
+	router.mutex.Lock()
+	defer router.mutex.Unlock()
+
+	return cmd.Public || router.allowed[strings.ToLower(name)]
+}
+
+// Adds a command, replacing any other with the same name or alias.
+func (router *Router) Register(cmd *Command) {
+	router.mutex.Lock()
+	defer router.mutex.Unlock()
+
+	router.commands[strings.ToLower(cmd.Name)] = cmd
+	for _, alias := range cmd.Aliases {
+		router.commands[strings.ToLower(alias)] = cmd
+	}
+}
+
+// Returns the command with a name or alias.
+func (router *Router) Lookup(name string) (cmd *Command, ok bool) {
+	router.mutex.Lock()
+	defer router.mutex.Unlock()
+
+	cmd, ok = router.commands[strings.ToLower(name)]
+	return cmd, ok
+}
+
+// Returns the commands sorted by name.
+func (router *Router) Commands() (cmds []*Command) {
+	router.mutex.Lock()
+	defer router.mutex.Unlock()
+
+	for name, cmd := range router.commands {
+		if name == strings.ToLower(cmd.Name) {
+			cmds = append(cmds, cmd)
+		}
+	}
+
+	sort.Slice(cmds, func(i, j int) bool {
+		return cmds[i].Name < cmds[j].Name
+	})
+
+	return cmds
+}
+
+// Starts handling commands in the client's chat, returning a function that stops it.
+func (router *Router) Attach() (detach func()) {
+	return router.Client.OnChat(router.HandleMessage)
+}
+
+// Runs the command in a chat message, if it contains one. The command runs in its own
+// goroutine, so it may take as long as it needs.
+func (router *Router) HandleMessage(msg mcclient.ChatMessage) {
+	line := msg.Message
+
+	switch msg.Type {
+	case mcclient.ChatWhisper:
+
+	case mcclient.ChatPlayer:
+		if router.Prefix == "" || !strings.HasPrefix(line, router.Prefix) {
+			return
+		}
+
+		line = line[len(router.Prefix):]
+
+	default:
+		return
+	}
+
+	if msg.Sender == "" || strings.EqualFold(msg.Sender, router.Client.ChatParser.Username) {
+		return
+	}
+
+	go router.Run(msg, line)
+}
+
+// Parses and runs a command line sent by a player, replying with any error.
+func (router *Router) Run(msg mcclient.ChatMessage, line string) {
+	ctx := &Context{
+		Router:  router,
+		Client:  router.Client,
+		Message: msg,
+		Sender:  msg.Sender,
+	}
+
+	err := router.run(ctx, line)
+	if err != nil {
+		ctx.Reply("%s", err.Error())
+	}
+}
+
+func (router *Router) run(ctx *Context, line string) (err error) {
+	words, err := SplitArgs(line)
+	if err != nil {
+		return err
+	}
+
+	if len(words) == 0 {
+		return nil
+	}
+
+	cmd, ok := router.Lookup(words[0])
+	if !ok {
+		return fmt.Errorf("Unknown command '%s'; say 'help' for a list", words[0])
+	}
+
+	if !router.Allowed(ctx.Sender, cmd) {
+		return fmt.Errorf("You are not allowed to use '%s'", cmd.Name)
+	}
+
+	ctx.Command = cmd
+	ctx.Args = words[1:]
+
+	if len(ctx.Args) < cmd.MinArgs || (cmd.MaxArgs >= 0 && len(ctx.Args) > cmd.MaxArgs) {
+		return fmt.Errorf("Usage: %s", usage(cmd))
+	}
+
+	return cmd.Handler(ctx)
+}
+
+func (router *Router) help(ctx *Context) (err error) {
+	if len(ctx.Args) > 0 {
+		cmd, ok := router.Lookup(ctx.Args[0])
+		if !ok {
+			return fmt.Errorf("Unknown command '%s'", ctx.Args[0])
+		}
+
+		return ctx.Reply("%s - %s", usage(cmd), cmd.Help)
+	}
+
+	var names []string
+	for _, cmd := range router.Commands() {
+		if router.Allowed(ctx.Sender, cmd) {
+			names = append(names, cmd.Name)
+		}
+	}
+
+	return ctx.Reply("Commands: %s", strings.Join(names, ", "))
+}
+
+func usage(cmd *Command) (s string) {
+	if cmd.Usage == "" {
+		return cmd.Name
+	}
+
+	return cmd.Name + " " + cmd.Usage
+}
+
+// Splits a command line into words separated by spaces. Double quotes group words
+// together, and a backslash escapes the next character.
+func SplitArgs(line string) (words []string, err error) {
+	var word []rune
+	inWord, quoted, escaped := false, false, false
+
+	for _, c := range line {
+		switch {
+		case escaped:
+			word = append(word, c)
+			escaped = false
+
+		case c == '\\':
+			inWord, escaped = true, true
+
+		case c == '"':
+			inWord, quoted = true, !quoted
+
+		case unicode.IsSpace(c) && !quoted:
+			if inWord {
+				words = append(words, string(word))
+				word, inWord = nil, false
+			}
+
+		default:
+			word = append(word, c)
+			inWord = true
+		}
+	}
+
+	if quoted {
+		return nil, fmt.Errorf("Unterminated quote")
+	}
+
+	if inWord {
+		words = append(words, string(word))
+	}
+
+	return words, nil
+}
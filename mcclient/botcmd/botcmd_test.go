@@ -0,0 +1,95 @@
+package botcmd
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSplitArgs(t *testing.T) {
+	tests := []struct {
+		line  string
+		words []string
+		err   bool
+	}{
+		{"", nil, false},
+		{"   ", nil, false},
+		{"chop 10", []string{"chop", "10"}, false},
+		{"  chop \t 10  ", []string{"chop", "10"}, false},
+		{`say "hello world"`, []string{"say", "hello world"}, false},
+		{`say "hello "world`, []string{"say", "hello world"}, false},
+		{`say ""`, []string{"say", ""}, false},
+		{`say hello\ world`, []string{"say", "hello world"}, false},
+		{`say \"hello\"`, []string{"say", `"hello"`}, false},
+		{`say "a \" b"`, []string{"say", `a " b`}, false},
+		{`say \\`, []string{"say", `\`}, false},
+		{`say "hello`, nil, true},
+		{`say hello"`, nil, true},
+	}
+
+	for _, test := range tests {
+		words, err := SplitArgs(test.line)
+
+		if (err != nil) != test.err {
+			t.Errorf("SplitArgs(%q): got error %v", test.line, err)
+			continue
+		}
+
+		if !reflect.DeepEqual(words, test.words) {
+			t.Errorf("SplitArgs(%q): got %q, expected %q", test.line, words, test.words)
+		}
+	}
+}
+
+func TestRouterRun(t *testing.T) {
+	router := NewRouter(nil)
+	router.Allow("Alice")
+
+	var ran []string
+
+	handler := func(ctx *Context) (err error) {
+		ran = append(ran, ctx.Command.Name)
+		return nil
+	}
+
+	router.Register(&Command{Name: "chop", Aliases: []string{"c"}, MaxArgs: 1, Handler: handler})
+	router.Register(&Command{Name: "say", MinArgs: 1, MaxArgs: -1, Handler: handler})
+	router.Register(&Command{Name: "where", Public: true, Handler: handler})
+
+	tests := []struct {
+		sender string
+		line   string
+		ran    bool
+		err    string
+	}{
+		{"Alice", "chop", true, ""},
+		{"alice", "CHOP 3", true, ""},
+		{"Alice", "c 3", true, ""},
+		{"Alice", "chop 3 4", false, "Usage: chop"},
+		{"Alice", "say", false, "Usage: say"},
+		{"Alice", "say a b c d", true, ""},
+		{"Alice", "dance", false, "Unknown command 'dance'; say 'help' for a list"},
+		{"Alice", `say "oops`, false, "Unterminated quote"},
+		{"Alice", "", false, ""},
+		{"Bob", "chop", false, "You are not allowed to use 'chop'"},
+		{"Bob", "where", true, ""},
+	}
+
+	for _, test := range tests {
+		ran = nil
+
+		err := router.run(&Context{Router: router, Sender: test.sender}, test.line)
+
+		msg := ""
+		if err != nil {
+			msg = err.Error()
+		}
+
+		if msg != test.err {
+			t.Errorf("%s: %q: got error %q, expected %q", test.sender, test.line, msg, test.err)
+		}
+
+		if (len(ran) > 0) != test.ran {
+			t.Errorf("%s: %q: handler ran: %v, expected %v", test.sender, test.line, len(ran) > 0, test.ran)
+		}
+	}
+}
@@ -5,18 +5,23 @@ import (
 	"fmt"
 	"github.com/kierdavis/ansi"
 	"github.com/kierdavis/mc/mcclient"
+	"github.com/kierdavis/mc/mcclient/botcmd"
+	"github.com/kierdavis/mc/resources"
 	"io"
 	"os"
-	"regexp"
+	"strings"
+	"sync"
 	"time"
 )
 
-var WhisperRegexp = regexp.MustCompile("^\xC2\xA77([a-zA-Z0-9_]+) whispers (.+)")
-
 var (
 	usernameP = flag.String("username", "Woodcutter", "The username the bot will log in with.")
 	passwordP = flag.String("password", "", "The password the bot will log in with. If not specified, no authentication occurs and the server is expected to be in offline mode.")
 	debugP    = flag.Bool("debug", false, "Whether to show debug messages.")
+	radiusP   = flag.Int("radius", 64, "How far from the bot to look for trees, in blocks.")
+	allowP    = flag.String("allow", "", "A comma-separated list of the players who may give the bot commands.")
+	prefixP   = flag.String("prefix", "!", "The prefix for commands said in public chat. Commands may also be whispered.")
+	chatlogP  = flag.String("chatlog", "", "A directory to log chat messages in.")
 )
 
 func die(err error) {
@@ -68,17 +73,29 @@ func main() {
 	}
 
 	client.StoreWorld = true
-	client.HandleMessage = func(msg string) {
-		matches := WhisperRegexp.FindStringSubmatch(msg)
-		if matches != nil {
-			ansi.Printf(ansi.YellowBold, "Message from %s: %s\n", matches[1], matches[2])
-			client.Chat(fmt.Sprintf("/tell %s %s", matches[1], matches[2]))
+	client.Physics = true
+	client.OnChat(func(msg mcclient.ChatMessage) {
+		if msg.Type == mcclient.ChatWhisper {
+			ansi.Printf(ansi.YellowBold, "Message from %s: %s\n", msg.Sender, msg.Message)
 		}
+	})
 
-		//fmt.Printf("# %s\n", mcclient.ANSIEscapes(msg))
-		//fmt.Printf("# %s\n", msg)
+	if *chatlogP != "" {
+		logger, err := mcclient.NewChatLogger(*chatlogP)
+		die(err)
+		defer logger.Close()
+		logger.Attach(client)
 	}
 
+	router := botcmd.NewRouter(client)
+	router.Prefix = *prefixP
+	if *allowP != "" {
+		router.Allow(strings.Split(*allowP, ",")...)
+	}
+
+	registerCommands(router, &bot{client: client})
+	router.Attach()
+
 	go func() {
 		/*
 			for err := range client.ErrChan {
@@ -94,176 +111,289 @@ func main() {
 
 	ansi.Printf(ansi.Green, "Connected!\n")
 
-	go bot(client)
-
 	kickMessage := client.Run()
 	ansi.Printf(ansi.Green, "Disconnected: %s\n", kickMessage)
 }
 
-func bot(client *mcclient.Client) {
-	for {
-		time.Sleep(time.Second * 5)
+// Runs one job at a time, such as walking somewhere or chopping trees.
+type bot struct {
+	client *mcclient.Client
+	mutex  sync.Mutex
+	cancel chan struct{} // Closed to stop the current job.
+	done   chan struct{} // Closed when the current job has stopped.
+}
+
+// Stops the current job and starts a new one in the background. The job should return
+// soon after cancel is closed.
+func (b *bot) start(job func(cancel <-chan struct{})) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
 
-		p, ok := findNearestTree(client)
-		if !ok {
-			return
-		}
+	b.stopLocked()
 
-		ansi.Printf(ansi.Green, "Found tree: %d, %d, %d\n", p.x, p.y, p.z)
+	cancel, done := make(chan struct{}), make(chan struct{})
+	b.cancel, b.done = cancel, done
 
-		chop(client, p)
+	go func() {
+		defer close(done)
+		defer b.client.StopWalking()
+		job(cancel)
+	}()
+}
+
+// Stops the current job, waiting for it to finish, and reports whether there was one.
+func (b *bot) stop() (stopped bool) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	return b.stopLocked()
+}
+
+func (b *bot) stopLocked() (stopped bool) {
+	if b.cancel == nil {
+		return false
 	}
+
+	cancel, done := b.cancel, b.done
+	b.cancel, b.done = nil, nil
+
+	select {
+	case <-done:
+		return false // The job had already finished.
+	default:
+	}
+
+	close(cancel)
+	<-done
+	return true
 }
 
-type xyz struct {
-	x, y, z int
+func registerCommands(router *botcmd.Router, b *bot) {
+	router.Register(&botcmd.Command{
+		Name:    "come",
+		Help:    "Walks to you.",
+		Handler: b.come,
+	})
+
+	router.Register(&botcmd.Command{
+		Name:    "stop",
+		Help:    "Stops what I am doing.",
+		Handler: b.stopCommand,
+	})
+
+	router.Register(&botcmd.Command{
+		Name:    "chop",
+		Usage:   "[trees]",
+		Help:    "Chops down the nearest trees, one by default.",
+		MaxArgs: 1,
+		Handler: b.chopCommand,
+	})
 }
 
-func findNearestTree(client *mcclient.Client) (p xyz, ok bool) {
-	p = xyz{int(client.PlayerX), int(client.PlayerY), int(client.PlayerZ)}
-	radius := 1
-	x := -radius
-	z := -radius
-	p.x -= radius
-	p.z -= radius
-	dir := 1
-
-mainloop:
-	for {
-		//fmt.Scanln()
-
-		block, _, _, _, _, ok := client.GetBlock(p.x, p.y, p.z)
-		if !ok {
-			ansi.Printf(ansi.RedBold, "No log found!\n")
-			return p, false
+func (b *bot) come(ctx *botcmd.Context) (err error) {
+	player, ok := b.client.PlayerByName(ctx.Sender)
+	if !ok {
+		return fmt.Errorf("I can't see you")
+	}
+
+	goal := mcclient.BlockCoordAt(player.X, player.Y, player.Z)
+
+	b.start(func(cancel <-chan struct{}) {
+		err := b.client.WalkPath(goal, &mcclient.PathOptions{Range: 2, Cancel: cancel})
+
+		switch err {
+		case nil:
+			ctx.Reply("Here I am")
+		case mcclient.ErrCancelled:
+		default:
+			ctx.Reply("I couldn't get to you: %s", err.Error())
 		}
+	})
 
-		//println(p.x, p.y, p.z, block)
+	return ctx.Reply("Coming")
+}
 
-		if block == 0 {
-			under, _, _, _, _, _ := client.GetBlock(p.x, p.y-1, p.z)
+func (b *bot) stopCommand(ctx *botcmd.Context) (err error) {
+	if !b.stop() {
+		return ctx.Reply("I wasn't doing anything")
+	}
+
+	return ctx.Reply("Stopped")
+}
 
-			if under == 0 {
-				p.y--
+func (b *bot) chopCommand(ctx *botcmd.Context) (err error) {
+	trees, err := ctx.IntOr(0, 1)
+	if err != nil {
+		return err
+	}
 
-			} else {
-				if (dir > 0 && x == radius) || (dir < 0 && x == -radius) {
-					if (dir > 0 && z == radius) || (dir < 0 && z == -radius) {
-						if dir < 0 {
-							radius++
-							x = -radius
-							z = -radius
+	if trees < 1 {
+		return fmt.Errorf("I can't chop %d trees", trees)
+	}
 
-							p.x -= 1
-							p.z -= 1
-						}
+	b.start(func(cancel <-chan struct{}) {
+		// Trees that could not be chopped, which are not tried again.
+		skip := make(map[xyz]bool)
+		chopped := 0
 
-						dir = -dir
+		for chopped < trees {
+			p, ok := findNearestTree(b.client, skip)
+			if !ok {
+				ctx.Reply("I can't find any more trees; chopped %d", chopped)
+				return
+			}
 
-					} else {
-						z += dir
-						p.z += dir
-					}
+			ansi.Printf(ansi.Green, "Found tree: %d, %d, %d\n", p.x, p.y, p.z)
 
-				} else {
-					x += dir
-					p.x += dir
-				}
+			err := chop(b.client, p, cancel)
+			if err == mcclient.ErrCancelled {
+				return
 			}
 
-		} else if block == 17 {
-			// We found log!
+			if err != nil {
+				ctx.Reply("I couldn't chop the tree at (%d, %d, %d): %s", p.x, p.y, p.z, err.Error())
+				skip[p] = true
+				continue
+			}
 
-			n := p
+			chopped++
+		}
 
-			for {
-				n.y++
+		ctx.Reply("Chopped %d trees", chopped)
+	})
 
-				block, _, _, _, _, ok = client.GetBlock(n.x, n.y, n.z)
+	return ctx.Reply("Chopping %d trees", trees)
+}
 
-				if block == 17 { // Log
-					continue
+type xyz struct {
+	x, y, z int
+}
 
-				} else if block == 18 { // Leaves, always found above a tree
-					break
+// Finds the bottom log of the nearest tree not in skip: a trunk of logs with leaves on
+// top.
+func findNearestTree(client *mcclient.Client, skip map[xyz]bool) (p xyz, ok bool) {
+	world := client.World.Snapshot()
 
-				} else { // Not a log
-					continue mainloop
-				}
-			}
+	isTreeBase := func(x int, y int, z int, block mcclient.Block) bool {
+		if !block.Is(resources.Log) || skip[xyz{x, y, z}] {
+			return false
+		}
 
-			for {
-				block, _, _, _, _, ok = client.GetBlock(p.x, p.y-1, p.z)
+		below, _ := world.GetBlock(x, y-1, z)
+		if below.Is(resources.Log) {
+			return false
+		}
 
-				if block == 17 {
-					p.y--
-					continue
+		for {
+			y++
 
-				} else { // Bottom block of trunk
-					return p, true
-				}
+			above, ok := world.GetBlock(x, y, z)
+			if !ok || !above.Is(resources.Log) {
+				return ok && above.Is(resources.Leaves)
 			}
-
-		} else {
-			p.y++
 		}
 	}
 
-	return p, false
+	centre := mcclient.BlockCoordAt(client.Position())
+
+	found, ok := world.NearestBlock(centre, *radiusP, isTreeBase)
+	if !ok {
+		ansi.Printf(ansi.RedBold, "No log found!\n")
+		return p, false
+	}
+
+	return xyz{found.X, found.Y, found.Z}, true
 }
 
-func moveTo(client *mcclient.Client, p xyz) {
+// Walks to the block next to the tree whose bottom log is at p, finding a path around
+// obstacles. It returns
+// mcclient.ErrCancelled if cancelled.
+func moveTo(client *mcclient.Client, p xyz, cancel <-chan struct{}) (err error) {
 	p.x++ // Dont stand in the tree!
 
-	ticker := time.NewTicker(mcclient.Tick)
+	x, y, z := client.Position()
+	ansi.Printf(ansi.Green, "Moving from (%d, %d, %d) to (%d, %d, %d)\n", int(x), int(y), int(z), p.x, p.y, p.z)
 
-	ansi.Printf(ansi.Green, "Moving from (%d, %d, %d) to (%d, %d, %d)\n", int(client.PlayerX), int(client.PlayerY), int(client.PlayerZ), p.x, p.y, p.z)
+	err = client.WalkPath(mcclient.BlockCoord{X: p.x, Y: p.y, Z: p.z}, &mcclient.PathOptions{Range: 1, Cancel: cancel})
+	if err != nil {
+		ansi.Printf(ansi.RedBold, "Could not reach the tree: %s\n", err.Error())
+		return err
+	}
 
-	for (int(client.PlayerX) != p.x) || (int(client.PlayerY) != p.y) || (int(client.PlayerZ) != p.z) {
+	ansi.Printf(ansi.Green, "Done moving\n")
+	return nil
+}
 
-		//println(client.PlayerX, client.PlayerY, client.PlayerZ)
+// Chops down the tree whose bottom log is at base, standing next to it and digging the
+// logs from the bottom up. It returns mcclient.ErrCancelled if cancelled.
+func chop(client *mcclient.Client, base xyz, cancel <-chan struct{}) (err error) {
+	err = moveTo(client, base, cancel)
+	if err != nil {
+		return err
+	}
 
-		if int(client.PlayerX) < p.x {
-			client.PlayerX += 0.2
-		} else if int(client.PlayerX) > p.x {
-			client.PlayerX -= 0.2
+	for p := base; ; p.y++ {
+		block, _ := client.GetBlock(p.x, p.y, p.z)
+		if !block.Is(resources.Log) {
+			return nil
 		}
 
-		if int(client.PlayerY) < p.y {
-			client.PlayerY += 0.2
-		} else if int(client.PlayerY) > p.y {
-			client.PlayerY -= 0.2
-		}
+		// The player may have been pushed away from the tree since reaching it.
+		if !inReach(client, p) {
+			err = moveTo(client, base, cancel)
+			if err != nil {
+				return err
+			}
 
-		if int(client.PlayerZ) < p.z {
-			client.PlayerZ += 0.2
-		} else if int(client.PlayerZ) > p.z {
-			client.PlayerZ -= 0.2
+			if !inReach(client, p) {
+				return fmt.Errorf("The log at (%d, %d, %d) is out of reach", p.x, p.y, p.z)
+			}
 		}
 
-		client.PlayerStance = client.PlayerY + 1.0
-		die(client.SendPacket(0x0D, client.PlayerX, client.PlayerY, client.PlayerStance, client.PlayerZ, client.PlayerYaw, client.PlayerPitch, client.PlayerOnGround))
+		ansi.Printf(ansi.Green, "Breaking block at (%d, %d, %d)\n", p.x, p.y, p.z)
+		client.LookAtBlock(mcclient.BlockCoord{X: p.x, Y: p.y, Z: p.z})
 
-		<-ticker.C
-	}
+		// The server only lets a dig finish once the block has had time to break.
+		ticks, _ := resources.BlockBreakTicks(block.ID)
 
-	ansi.Printf(ansi.Green, "Done moving\n")
-}
+		err = client.SendPacket(0x0E, int8(0), int32(p.x), int8(p.y), int32(p.z), int8(5))
+		if err != nil {
+			return err
+		}
 
-func chop(client *mcclient.Client, p xyz) {
-	for {
-		block, _, _, _, _, _ := client.GetBlock(p.x, p.y, p.z)
+		select {
+		case <-cancel:
+			return mcclient.ErrCancelled
+		case <-time.After(mcclient.Tick * time.Duration(ticks+1)):
+		}
 
-		if block == 17 {
-			moveTo(client, p)
-			ansi.Printf(ansi.Green, "Breaking block at (%d, %d, %d)\n", p.x, p.y, p.z)
-			die(client.SendPacket(0x0E, int8(0), int32(p.x), int8(p.y), int32(p.z), int8(5)))
-			die(client.SendPacket(0x0E, int8(2), int32(p.x), int8(p.y), int32(p.z), int8(5)))
-			time.Sleep(time.Second * 3)
-			p.y++
+		err = client.SendPacket(0x0E, int8(2), int32(p.x), int8(p.y), int32(p.z), int8(5))
+		if err != nil {
+			return err
+		}
+
+		broken := false
+		for i := 0; i < 20 && !broken; i++ {
+			select {
+			case <-cancel:
+				return mcclient.ErrCancelled
+			case <-time.After(mcclient.Tick):
+			}
+
+			block, _ = client.GetBlock(p.x, p.y, p.z)
+			broken = !block.Is(resources.Log)
+		}
 
-		} else {
-			break
+		if !broken {
+			return fmt.Errorf("The log at (%d, %d, %d) did not break", p.x, p.y, p.z)
 		}
 	}
 }
+
+// Reports whether the centre of the block at p is within reach of the player's eyes.
+func inReach(client *mcclient.Client, p xyz) (ok bool) {
+	x, y, z := client.EyePosition()
+	dx, dy, dz := float64(p.x)+0.5-x, float64(p.y)+0.5-y, float64(p.z)+0.5-z
+
+	return dx*dx+dy*dy+dz*dz <= mcclient.Reach*mcclient.Reach
+}
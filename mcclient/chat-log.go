@@ -0,0 +1,302 @@
+package mcclient
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The default for ChatLogger.MaxSize.
+const DefaultChatLogSize = 16 << 20
+
+// Writes chat messages to log files in a directory, as plain text (.log) and as JSON
+// lines (.jsonl), with colour escapes removed. A new pair of files is started each day
+// and whenever the text file grows past MaxSize, named like "chat-2006-01-02.log",
+// "chat-2006-01-02.1.log" and so on.
+type ChatLogger struct {
+	Dir     string
+	Prefix  string // The start of the file names. Defaults to "chat".
+	MaxSize int64  // The size in bytes at which to start new files; 0 for no limit.
+
+	mutex    sync.Mutex
+	textFile *os.File
+	jsonFile *os.File
+	day      string
+	part     int
+	size     int64
+}
+
+// One line of a JSON chat log.
+type ChatLogEntry struct {
+	Time      time.Time `json:"time"`
+	Type      ChatType  `json:"type"`
+	Sender    string    `json:"sender,omitempty"`
+	Recipient string    `json:"recipient,omitempty"`
+	Message   string    `json:"message"`
+	Text      string    `json:"text"` // The whole message, without colour escapes.
+}
+
+// Creates a logger writing to a directory, creating it if necessary.
+func NewChatLogger(dir string) (logger *ChatLogger, err error) {
+	err = os.MkdirAll(dir, 0755)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ChatLogger{Dir: dir, Prefix: "chat", MaxSize: DefaultChatLogSize}, nil
+}
+
+// Logs every chat message the client receives, returning a function that stops it.
+// Errors are written to the client's DebugWriter.
+func (logger *ChatLogger) Attach(client *Client) (detach func()) {
+	return client.OnChat(func(msg ChatMessage) {
+		err := logger.Log(msg)
+		if err != nil && client.DebugWriter != nil {
+			fmt.Fprintf(client.DebugWriter, "Could not log chat message: %s\n", err.Error())
+		}
+	})
+}
+
+// Writes a message to the logs.
+func (logger *ChatLogger) Log(msg ChatMessage) (err error) {
+	logger.mutex.Lock()
+	defer logger.mutex.Unlock()
+
+	err = logger.rotate(msg.Time)
+	if err != nil {
+		return err
+	}
+
+	entry := ChatLogEntry{
+		Time:      msg.Time,
+		Type:      msg.Type,
+		Sender:    msg.Sender,
+		Recipient: msg.Recipient,
+		Message:   NoEscapes(msg.Message),
+		Text:      NoEscapes(msg.Text),
+	}
+
+	line := fmt.Sprintf("%s [%s] %s\n", entry.Time.Format("2006-01-02 15:04:05"), entry.Type, entry.Text)
+
+	n, err := logger.textFile.WriteString(line)
+	logger.size += int64(n)
+	if err != nil {
+		return err
+	}
+
+	// Don't escape the <> around player names.
+	encoder := json.NewEncoder(logger.jsonFile)
+	encoder.SetEscapeHTML(false)
+	return encoder.Encode(entry)
+}
+
+// Opens the files for a message logged at t, if they are not already open. The caller
+// must hold mutex.
+func (logger *ChatLogger) rotate(t time.Time) (err error) {
+	day := t.Format("2006-01-02")
+
+	if logger.textFile != nil && day == logger.day && (logger.MaxSize <= 0 || logger.size < logger.MaxSize) {
+		return nil
+	}
+
+	logger.close()
+
+	if day != logger.day {
+		logger.day, logger.part = day, 0
+	} else {
+		logger.part++
+	}
+
+	// Carry on from the last part written today, if it has room.
+	for {
+		info, err := os.Stat(logger.filename(".log"))
+		if os.IsNotExist(err) {
+			logger.size = 0
+			break
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if logger.MaxSize <= 0 || info.Size() < logger.MaxSize {
+			logger.size = info.Size()
+			break
+		}
+
+		logger.part++
+	}
+
+	logger.textFile, err = os.OpenFile(logger.filename(".log"), os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+
+	logger.jsonFile, err = os.OpenFile(logger.filename(".jsonl"), os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		logger.close()
+		return err
+	}
+
+	// A crash may have left the last line unfinished; start a new one after it.
+	for _, f := range []*os.File{logger.textFile, logger.jsonFile} {
+		if !endsWithNewline(f.Name()) {
+			_, err = f.WriteString("\n")
+			if err != nil {
+				logger.close()
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// Reports whether a file is empty or ends with a newline.
+func endsWithNewline(filename string) (ok bool) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return true
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil || info.Size() == 0 {
+		return true
+	}
+
+	last := make([]byte, 1)
+	_, err = f.ReadAt(last, info.Size()-1)
+	return err != nil || last[0] == '\n'
+}
+
+// Returns the name of the current file with an extension.
+func (logger *ChatLogger) filename(ext string) (filename string) {
+	prefix := logger.Prefix
+	if prefix == "" {
+		prefix = "chat"
+	}
+
+	name := prefix + "-" + logger.day
+	if logger.part > 0 {
+		name += fmt.Sprintf(".%d", logger.part)
+	}
+
+	return filepath.Join(logger.Dir, name+ext)
+}
+
+// Closes the log files.
+func (logger *ChatLogger) Close() (err error) {
+	logger.mutex.Lock()
+	defer logger.mutex.Unlock()
+
+	return logger.close()
+}
+
+func (logger *ChatLogger) close() (err error) {
+	if logger.textFile != nil {
+		err = logger.textFile.Close()
+		logger.textFile = nil
+	}
+
+	if logger.jsonFile != nil {
+		err2 := logger.jsonFile.Close()
+		if err == nil {
+			err = err2
+		}
+
+		logger.jsonFile = nil
+	}
+
+	return err
+}
+
+// What to look for in chat logs. Empty fields match everything.
+type ChatLogQuery struct {
+	Player string // Matches the sender or recipient, ignoring case.
+	Since  time.Time
+	Until  time.Time
+	Text   string // Matches messages containing the text, ignoring case.
+}
+
+// Reports whether an entry matches the query.
+func (query ChatLogQuery) Match(entry ChatLogEntry) (match bool) {
+	if query.Player != "" && !strings.EqualFold(entry.Sender, query.Player) && !strings.EqualFold(entry.Recipient, query.Player) {
+		return false
+	}
+
+	if !query.Since.IsZero() && entry.Time.Before(query.Since) {
+		return false
+	}
+
+	if !query.Until.IsZero() && !entry.Time.Before(query.Until) {
+		return false
+	}
+
+	return query.Text == "" || strings.Contains(strings.ToLower(entry.Text), strings.ToLower(query.Text))
+}
+
+// Returns the entries in the JSON logs in a directory that match a query, oldest first.
+// Lines that cannot be parsed, such as one cut short by a crash while it was written, are
+// skipped, with a warning written to warnings if it is not nil.
+func SearchChatLogs(dir string, query ChatLogQuery, warnings io.Writer) (entries []ChatLogEntry, err error) {
+	filenames, err := filepath.Glob(filepath.Join(dir, "*.jsonl"))
+	if err != nil {
+		return nil, err
+	}
+
+	for _, filename := range filenames {
+		entries, err = searchChatLog(filename, query, warnings, entries)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Time.Before(entries[j].Time)
+	})
+
+	return entries, nil
+}
+
+func searchChatLog(filename string, query ChatLogQuery, warnings io.Writer, entries []ChatLogEntry) (result []ChatLogEntry, err error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 1<<20)
+
+	for line := 1; scanner.Scan(); line++ {
+		var entry ChatLogEntry
+
+		err = json.Unmarshal(scanner.Bytes(), &entry)
+		if err != nil {
+			if warnings != nil {
+				fmt.Fprintf(warnings, "Skipping %s:%d: %s\n", filename, line, err.Error())
+			}
+
+			continue
+		}
+
+		if query.Match(entry) {
+			entries = append(entries, entry)
+		}
+	}
+
+	err = scanner.Err()
+	if err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
@@ -0,0 +1,273 @@
+package mcclient
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// The longest chat message a client may send, in characters.
+const MaxChatLength = 100
+
+// The defaults for Client.ChatRate and Client.ChatBurst. A vanilla server kicks players
+// who average more than one message a second over a burst of about ten.
+const (
+	DefaultChatRate  = 0.8
+	DefaultChatBurst = 5
+)
+
+// Commands whose text can be split across several messages by repeating the start of
+// the command, such as "/tell Name ".
+var splittableCommandRegexp = regexp.MustCompile(`^/(?:(?:tell|msg|w|whisper|m|t|pm) [^ ]+|r|reply|me|say) `)
+
+// Removes characters that a server will not accept in chat: control characters, and
+// colour escapes unless escapes is set.
+func StripIllegalChat(msg string, escapes bool) (output string) {
+	return strings.Map(func(c rune) rune {
+		if c < ' ' || c == 0x7F || (c == EscapeChar && !escapes) || c == utf8.RuneError {
+			return -1
+		}
+
+		return c
+	}, msg)
+}
+
+// Splits a message into parts of no more than limit characters, breaking at spaces where
+// possible. Whisper commands such as "/tell Name message" are split by repeating the
+// start of the command in every part; other commands cannot be split. If escapes is set,
+// each part starts with the escapes needed to continue the colour and formatting of the
+// part before it.
+func SplitChat(msg string, limit int, escapes bool) (parts []string, err error) {
+	if utf8.RuneCountInString(msg) <= limit {
+		return []string{msg}, nil
+	}
+
+	prefix := splittableCommandRegexp.FindString(msg)
+	if prefix == "" && strings.HasPrefix(msg, "/") {
+		return nil, fmt.Errorf("Command is too long to send: %s", msg)
+	}
+
+	body := msg[len(prefix):]
+	limit -= utf8.RuneCountInString(prefix)
+	if limit < 1 {
+		return nil, fmt.Errorf("Command is too long to split: %s", prefix)
+	}
+
+	var spans []Span
+	if escapes {
+		spans = ParseFormatted(body)
+	} else {
+		spans = []Span{{Text: body, Colour: DefaultColour}}
+	}
+
+	// Words keep the space before them, which is dropped when a word starts a new part.
+	var words [][]styledRune
+	var word []styledRune
+
+	for _, span := range spans {
+		style := span
+		style.Text = ""
+
+		for _, c := range span.Text {
+			if c == ' ' && len(word) > 0 {
+				words = append(words, word)
+				word = nil
+			}
+
+			word = append(word, styledRune{c, style})
+		}
+	}
+
+	if len(word) > 0 {
+		words = append(words, word)
+	}
+
+	var part []styledRune
+
+	for _, word := range words {
+		if len(part) > 0 && formattedLength(append(part[:len(part):len(part)], word...)) <= limit {
+			part = append(part, word...)
+			continue
+		}
+
+		if len(part) > 0 {
+			parts = append(parts, prefix+formatStyledRunes(part))
+		}
+
+		if word[0].c == ' ' {
+			word = word[1:]
+		}
+
+		// Break up words too long to fit in a part on their own. Each part takes at
+		// least one character, which must fit with its escapes.
+		for formattedLength(word) > limit {
+			if formattedLength(word[:1]) > limit {
+				return nil, fmt.Errorf("Message cannot be split into parts of %d characters", limit)
+			}
+
+			n := len(word) - 1
+			for n > 1 && formattedLength(word[:n]) > limit {
+				n--
+			}
+
+			parts = append(parts, prefix+formatStyledRunes(word[:n]))
+			word = word[n:]
+		}
+
+		part = word
+	}
+
+	if len(part) > 0 {
+		parts = append(parts, prefix+formatStyledRunes(part))
+	}
+
+	return parts, nil
+}
+
+type styledRune struct {
+	c     rune
+	style Span
+}
+
+// Returns the runes as a string with escapes.
+func formatStyledRunes(runes []styledRune) (output string) {
+	var spans []Span
+
+	for _, r := range runes {
+		if len(spans) == 0 || !spans[len(spans)-1].SameStyle(r.style) {
+			spans = append(spans, r.style)
+		}
+
+		spans[len(spans)-1].Text += string(r.c)
+	}
+
+	return FormatSpans(spans)
+}
+
+func formattedLength(runes []styledRune) (length int) {
+	return utf8.RuneCountInString(formatStyledRunes(runes))
+}
+
+// Queues a chat message or command to be sent by ChatSender, after removing illegal
+// characters and splitting it if it is too long.
+func (client *Client) Chat(msg string) (err error) {
+	msg = StripIllegalChat(msg, client.ChatEscapes)
+
+	parts, err := SplitChat(msg, MaxChatLength, client.ChatEscapes)
+	if err != nil {
+		return err
+	}
+
+	client.chatQueueMutex.Lock()
+	for _, part := range parts {
+		if strings.TrimSpace(part) != "" {
+			client.chatQueue = append(client.chatQueue, part)
+		}
+	}
+	client.chatQueueMutex.Unlock()
+
+	select {
+	case client.chatReady <- struct{}{}:
+	default:
+	}
+
+	return nil
+}
+
+// Sends a chat message or command at once, bypassing the queue and the rate limit. The
+// message must be no longer than MaxChatLength.
+func (client *Client) ChatNow(msg string) (err error) {
+	return client.SendPacket(0x03, msg)
+}
+
+// Returns the number of messages waiting to be sent.
+func (client *Client) QueuedChat() (n int) {
+	client.chatQueueMutex.Lock()
+	defer client.chatQueueMutex.Unlock()
+
+	return len(client.chatQueue)
+}
+
+// Discards the messages waiting to be sent.
+func (client *Client) ClearChatQueue() {
+	client.chatQueueMutex.Lock()
+	client.chatQueue = nil
+	client.chatQueueMutex.Unlock()
+}
+
+// Returns the next message in the queue without removing it.
+func (client *Client) peekChat() (msg string, ok bool) {
+	client.chatQueueMutex.Lock()
+	defer client.chatQueueMutex.Unlock()
+
+	if len(client.chatQueue) == 0 {
+		return "", false
+	}
+
+	return client.chatQueue[0], true
+}
+
+// Removes the next message from the queue.
+func (client *Client) popChat() {
+	client.chatQueueMutex.Lock()
+	if len(client.chatQueue) > 0 {
+		client.chatQueue = client.chatQueue[1:]
+	}
+	client.chatQueueMutex.Unlock()
+}
+
+// Runs in the background, sending queued chat messages no faster than ChatRate messages
+// per second on average, with bursts of up to ChatBurst messages.
+func (client *Client) ChatSender() {
+	tokens := float64(client.ChatBurst)
+	last := time.Now()
+
+	for {
+		msg, ok := client.peekChat()
+		if !ok {
+			select {
+			case <-client.stopChatSender:
+				client.stopChatSender <- struct{}{}
+				return
+
+			case <-client.chatReady:
+			}
+
+			continue
+		}
+
+		if client.ChatRate > 0 {
+			now := time.Now()
+			tokens += now.Sub(last).Seconds() * client.ChatRate
+			if tokens > float64(client.ChatBurst) {
+				tokens = float64(client.ChatBurst)
+			}
+			last = now
+
+			if tokens < 1 {
+				wait := time.Duration((1 - tokens) / client.ChatRate * float64(time.Second))
+
+				select {
+				case <-client.stopChatSender:
+					client.stopChatSender <- struct{}{}
+					return
+
+				case <-time.After(wait):
+				}
+
+				continue
+			}
+
+			tokens--
+		}
+
+		client.popChat()
+
+		err := client.ChatNow(msg)
+		if err != nil {
+			client.ErrChan <- err
+		}
+	}
+}
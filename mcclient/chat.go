@@ -0,0 +1,201 @@
+package mcclient
+
+import (
+	"fmt"
+	"regexp"
+	"time"
+)
+
+// The kind of a chat message.
+type ChatType int
+
+const (
+	ChatUnknown     ChatType = iota // Anything not matched by a pattern, such as command output.
+	ChatPlayer                      // A player talking in public chat.
+	ChatWhisper                     // A private message sent to us.
+	ChatWhisperSent                 // The server echoing a private message we sent.
+	ChatJoin                        // A player joining the game.
+	ChatLeave                       // A player leaving the game.
+	ChatDeath                       // A player dying.
+	ChatBroadcast                   // A message from the server console or a broadcast command.
+)
+
+var chatTypeNames = []string{"unknown", "player", "whisper", "whisper-sent", "join", "leave", "death", "broadcast"}
+
+func (t ChatType) String() (name string) {
+	if t < 0 || int(t) >= len(chatTypeNames) {
+		return "unknown"
+	}
+
+	return chatTypeNames[t]
+}
+
+// Marshals a type as its name, so that it reads well in JSON.
+func (t ChatType) MarshalText() (text []byte, err error) {
+	return []byte(t.String()), nil
+}
+
+func (t *ChatType) UnmarshalText(text []byte) (err error) {
+	for i, name := range chatTypeNames {
+		if name == string(text) {
+			*t = ChatType(i)
+			return nil
+		}
+	}
+
+	return fmt.Errorf("Unknown chat message type: %s", text)
+}
+
+// A chat message received from the server.
+type ChatMessage struct {
+	Raw       string    // The message as received, including colour escapes.
+	Text      string    // The message with colour escapes removed.
+	Type      ChatType  // The kind of message.
+	Sender    string    // The player who sent or is the subject of the message, if any.
+	Recipient string    // The player a whisper was sent to, if any.
+	Message   string    // The text of the message without the sender's name and other decoration.
+	Time      time.Time // When the message was received.
+}
+
+// A regular expression matched against the text of a message (with colour escapes
+// removed) to classify it. The named groups "sender", "recipient" and "message" fill in
+// the fields of the same names; the whole text is used as the message if there is no
+// "message" group.
+type ChatPattern struct {
+	Type   ChatType
+	Regexp *regexp.Regexp
+}
+
+const playerNamePattern = `(?P<sender>[A-Za-z0-9_]{1,16})`
+
+// Patterns for the messages sent by a vanilla server, including the Beta-era whisper
+// format still used by some servers.
+var VanillaChatPatterns = []ChatPattern{
+	{ChatPlayer, regexp.MustCompile(`^<` + playerNamePattern + `> (?P<message>.*)$`)},
+	{ChatWhisper, regexp.MustCompile(`^` + playerNamePattern + ` whispers(?: to you:)? (?P<message>.*)$`)},
+	{ChatWhisperSent, regexp.MustCompile(`^You whisper to (?P<recipient>[A-Za-z0-9_]{1,16}): (?P<message>.*)$`)},
+	{ChatJoin, regexp.MustCompile(`^` + playerNamePattern + ` joined the game\.?$`)},
+	{ChatLeave, regexp.MustCompile(`^` + playerNamePattern + ` left the game\.?$`)},
+	{ChatBroadcast, regexp.MustCompile(`^\[Server\] (?P<message>.*)$`)},
+	{ChatDeath, regexp.MustCompile(`^` + playerNamePattern + ` (?P<message>(?:was (?:slain|shot|killed|fireballed|pummeled|pricked|squashed|blown up)|` +
+		`drowned|burned|blew up|hit the ground|fell|died|tried to swim in lava|suffocated|went up in flames|starved|withered away).*)$`)},
+}
+
+// Patterns for the private messages and broadcasts of the Essentials plugin.
+var EssentialsChatPatterns = []ChatPattern{
+	{ChatWhisper, regexp.MustCompile(`^\[` + playerNamePattern + ` -> me\] (?P<message>.*)$`)},
+	{ChatWhisperSent, regexp.MustCompile(`^\[me -> (?P<recipient>[A-Za-z0-9_]{1,16})\] (?P<message>.*)$`)},
+	{ChatBroadcast, regexp.MustCompile(`^\[Broadcast\] (?P<message>.*)$`)},
+}
+
+// Patterns for the "[Group] Name: message" chat format used by permissions and chat
+// formatting plugins. These are not in DefaultChatPatterns, as they also match some
+// command output.
+var PrefixedChatPatterns = []ChatPattern{
+	{ChatPlayer, regexp.MustCompile(`^(?:\[[^\]]*\] ?)*` + playerNamePattern + `: (?P<message>.*)$`)},
+}
+
+// The patterns used by a new ChatParser.
+var DefaultChatPatterns = append(append([]ChatPattern{}, VanillaChatPatterns...), EssentialsChatPatterns...)
+
+// Classifies chat messages by matching them against a list of patterns in order.
+type ChatParser struct {
+	Patterns []ChatPattern
+	Username string // Used as the recipient of whispers sent to us.
+}
+
+func NewChatParser(username string) (parser *ChatParser) {
+	return &ChatParser{
+		Patterns: append([]ChatPattern{}, DefaultChatPatterns...),
+		Username: username,
+	}
+}
+
+// Parses a message as received in packet 0x03.
+func (parser *ChatParser) Parse(raw string) (msg ChatMessage) {
+	text := NoEscapes(raw)
+	msg = ChatMessage{Raw: raw, Text: text, Message: text, Time: time.Now()}
+
+	for _, pattern := range parser.Patterns {
+		matches := pattern.Regexp.FindStringSubmatch(msg.Text)
+		if matches == nil {
+			continue
+		}
+
+		msg.Type = pattern.Type
+
+		for i, name := range pattern.Regexp.SubexpNames() {
+			switch name {
+			case "sender":
+				msg.Sender = matches[i]
+			case "recipient":
+				msg.Recipient = matches[i]
+			case "message":
+				msg.Message = matches[i]
+			}
+		}
+
+		switch msg.Type {
+		case ChatWhisper:
+			if msg.Recipient == "" {
+				msg.Recipient = parser.Username
+			}
+
+		case ChatWhisperSent:
+			if msg.Sender == "" {
+				msg.Sender = parser.Username
+			}
+		}
+
+		break
+	}
+
+	return msg
+}
+
+type chatHandler struct {
+	id      int
+	handler func(ChatMessage)
+}
+
+// Registers a function to be called with every chat message received, after it has been
+// parsed with the client's ChatParser, and returns a function that unregisters it.
+// Handlers are called in the order they were registered, on the goroutine reading
+// packets, so they should not block.
+func (client *Client) OnChat(handler func(ChatMessage)) (unsubscribe func()) {
+	client.chatMutex.Lock()
+	defer client.chatMutex.Unlock()
+
+	client.nextChatHandlerID++
+	id := client.nextChatHandlerID
+	client.chatHandlers = append(client.chatHandlers, chatHandler{id, handler})
+
+	return func() {
+		client.chatMutex.Lock()
+		defer client.chatMutex.Unlock()
+
+		for i, h := range client.chatHandlers {
+			if h.id == id {
+				client.chatHandlers = append(client.chatHandlers[:i:i], client.chatHandlers[i+1:]...)
+				return
+			}
+		}
+	}
+}
+
+// Parses a received message and passes it to the chat handlers.
+func (client *Client) dispatchChat(raw string) {
+	client.chatMutex.Lock()
+	handlers := client.chatHandlers
+	client.chatMutex.Unlock()
+
+	if len(handlers) == 0 {
+		return
+	}
+
+	msg := client.ChatParser.Parse(raw)
+
+	for _, h := range handlers {
+		h.handler(msg)
+	}
+}
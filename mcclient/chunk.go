@@ -1,6 +1,7 @@
 package mcclient
 
 import (
+	"bytes"
 	"io"
 )
 
@@ -9,6 +10,12 @@ type ColumnCoord struct {
 	Z int
 }
 
+// Returns the squared distance between two columns, in columns.
+func (coord ColumnCoord) distanceSq(other ColumnCoord) (d int) {
+	dx, dz := coord.X-other.X, coord.Z-other.Z
+	return dx*dx + dz*dz
+}
+
 type Column struct {
 	Chunks map[int]*Chunk
 	Biomes []byte
@@ -23,74 +30,182 @@ type Chunk struct {
 }
 
 func (client *Client) GetChunk(cx int, cy int, cz int) (chunk *Chunk, ok bool) {
-	column, ok := client.Columns[ColumnCoord{cx, cz}]
-	if !ok {
-		return nil, false
-	}
+	return client.World.GetChunk(cx, cy, cz)
+}
 
+func (client *Client) GetBlock(x int, y int, z int) (block Block, ok bool) {
+	return client.World.GetBlock(x, y, z)
+}
+
+// Changes the ID and metadata of a block in the stored world, keeping its light levels. It
+// returns false if the block's column is not loaded. The server is not told of the change.
+func (client *Client) SetBlock(x int, y int, z int, block Block) (ok bool) {
+	return client.World.SetBlock(x, y, z, block)
+}
+
+func (column *Column) GetChunk(cy int) (chunk *Chunk, ok bool) {
 	chunk, ok = column.Chunks[cy]
 	return chunk, ok
 }
 
-func (client *Client) GetBlock(x int, y int, z int) (blockType byte, blockData byte, blockLight byte, skyLight byte, addType byte, ok bool) {
-	chunk, ok := client.GetChunk(x>>4, y>>4, z>>4)
-	if !ok {
-		return 0, 0, 0, 0, 0, false
+// Returns the block at a position relative to the column's minimum corner. Chunks missing
+// from a loaded column are empty, so their blocks are air, with full sky light where
+// nothing above them blocks the sky.
+func (column *Column) GetBlock(x int, y int, z int) (block Block, ok bool) {
+	chunk, ok := column.GetChunk(y >> 4)
+	if ok {
+		block = chunk.GetBlock(x, y&15, z)
+	} else if column.openToSky(x, y>>4, z) {
+		block.SkyLight = 15
 	}
 
-	xOffset := x & 15
-	yOffset := y & 15
-	zOffset := z & 15
-	byteOffset := xOffset | (zOffset << 4) | (yOffset << 8)
+	block.Biome = UnknownBiome
 
-	if chunk.BlockTypes != nil {
-		blockType = chunk.BlockTypes[byteOffset]
+	if column.Biomes != nil {
+		block.Biome = column.Biomes[z<<4|x]
 	}
 
-	if chunk.BlockMetadata != nil {
-		blockData = chunk.BlockMetadata[byteOffset/2]
-		if byteOffset%2 == 0 {
-			blockData = blockData & 0x0F
-		} else {
-			blockData = blockData >> 4
+	return block, true
+}
+
+// Reports whether there are only air blocks above chunk cy at a position relative to the
+// column. Chunks that are all air are left out by the server, and by compactChunk when
+// they are also dark, so their sky light is lost; this tells whether it was full.
+func (column *Column) openToSky(x int, cy int, z int) (open bool) {
+	for cy++; cy < 16; cy++ {
+		chunk, ok := column.Chunks[cy]
+		if !ok || (chunk.BlockTypes == nil && chunk.AddTypes == nil) {
+			continue
 		}
-	}
 
-	if chunk.BlockLight != nil {
-		blockLight = chunk.BlockLight[byteOffset/2]
-		if byteOffset%2 == 0 {
-			blockLight = blockLight & 0x0F
-		} else {
-			blockLight = blockLight >> 4
+		for y := 0; y < 16; y++ {
+			if !chunk.GetBlock(x, y, z).IsAir() {
+				return false
+			}
 		}
 	}
 
-	if chunk.SkyLight != nil {
-		skyLight = chunk.SkyLight[byteOffset/2]
-		if byteOffset%2 == 0 {
-			skyLight = skyLight & 0x0F
-		} else {
-			skyLight = skyLight >> 4
+	return true
+}
+
+// Returns the sky light array for chunk cy, which must be missing from the column: full
+// where the chunk is open to the sky and dark elsewhere. It returns nil if it is dark
+// everywhere.
+func (column *Column) missingSkyLight(cy int) (skyLight []byte) {
+	for z := 0; z < 16; z++ {
+		for x := 0; x < 16; x++ {
+			if !column.openToSky(x, cy, z) {
+				continue
+			}
+
+			if skyLight == nil {
+				skyLight = make([]byte, 2048)
+			}
+
+			for y := 0; y < 16; y++ {
+				setNibble(skyLight, x|z<<4|y<<8, 15)
+			}
 		}
 	}
 
+	return skyLight
+}
+
+// Returns a copy of the column that shares its chunks.
+func (column *Column) copy() (result *Column) {
+	result = &Column{Chunks: make(map[int]*Chunk, len(column.Chunks)), Biomes: column.Biomes}
+
+	for cy, chunk := range column.Chunks {
+		result.Chunks[cy] = chunk
+	}
+
+	return result
+}
+
+// Returns the block at a position relative to the chunk's minimum corner. The chunk does
+// not know its biome, so Biome is left as zero.
+func (chunk *Chunk) GetBlock(x int, y int, z int) (block Block) {
+	byteOffset := x | (z << 4) | (y << 8)
+
+	if chunk.BlockTypes != nil {
+		block.ID = uint16(chunk.BlockTypes[byteOffset])
+	}
+
+	block.ID |= uint16(getNibble(chunk.AddTypes, byteOffset)) << 8
+	block.Metadata = getNibble(chunk.BlockMetadata, byteOffset)
+	block.BlockLight = getNibble(chunk.BlockLight, byteOffset)
+	block.SkyLight = getNibble(chunk.SkyLight, byteOffset)
+
+	return block
+}
+
+// Returns a copy of the chunk with its own block type, metadata and add type arrays,
+// ready to be modified. A nil chunk copies as an empty one. The add type array is only
+// created when it is first needed.
+func (chunk *Chunk) copy() (result *Chunk) {
+	result = new(Chunk)
+
+	if chunk != nil {
+		*result = *chunk
+	}
+
+	result.BlockTypes = copyOrMake(result.BlockTypes, 4096)
+	result.BlockMetadata = copyOrMake(result.BlockMetadata, 2048)
+
+	if result.AddTypes != nil {
+		result.AddTypes = copyOrMake(result.AddTypes, 2048)
+	}
+
+	return result
+}
+
+func (chunk *Chunk) setBlock(x int, y int, z int, id uint16, metadata byte) {
+	byteOffset := x | (z << 4) | (y << 8)
+	addType := byte(id >> 8)
+
+	chunk.BlockTypes[byteOffset] = byte(id)
+	setNibble(chunk.BlockMetadata, byteOffset, metadata)
+
+	if chunk.AddTypes == nil && addType != 0 {
+		chunk.AddTypes = make([]byte, 2048)
+	}
+
 	if chunk.AddTypes != nil {
-		addType = chunk.AddTypes[byteOffset/2]
-		if byteOffset%2 == 0 {
-			addType = addType & 0x0F
-		} else {
-			addType = addType >> 4
-		}
+		setNibble(chunk.AddTypes, byteOffset, addType)
+	}
+}
+
+func copyOrMake(data []byte, size int) (result []byte) {
+	result = make([]byte, size)
+	copy(result, data)
+	return result
+}
+
+func getNibble(data []byte, index int) (value byte) {
+	if data == nil {
+		return 0
 	}
 
-	return blockType, blockData, blockLight, skyLight, addType, true
+	if index%2 == 0 {
+		return data[index/2] & 0x0F
+	}
+
+	return data[index/2] >> 4
+}
+
+func setNibble(data []byte, index int, value byte) {
+	if index%2 == 0 {
+		data[index/2] = data[index/2]&0xF0 | value&0x0F
+	} else {
+		data[index/2] = data[index/2]&0x0F | value<<4
+	}
 }
 
 func (client *Client) readBlockTypes(r io.ReadCloser, column *Column, primaryBitMap uint16) (err error) {
 	for cy := 0; cy < 16; cy++ {
 		if primaryBitMap&(1<<uint(cy)) != 0 {
 			data := make([]byte, 4096)
-			_, err = r.Read(data)
+			_, err = io.ReadFull(r, data)
 			if err != nil {
 				return err
 			}
@@ -112,7 +227,7 @@ func (client *Client) readBlockMetadata(r io.ReadCloser, column *Column, primary
 	for cy := 0; cy < 16; cy++ {
 		if primaryBitMap&(1<<uint(cy)) != 0 {
 			data := make([]byte, 2048)
-			_, err = r.Read(data)
+			_, err = io.ReadFull(r, data)
 			if err != nil {
 				return err
 			}
@@ -134,7 +249,7 @@ func (client *Client) readBlockLight(r io.ReadCloser, column *Column, primaryBit
 	for cy := 0; cy < 16; cy++ {
 		if primaryBitMap&(1<<uint(cy)) != 0 {
 			data := make([]byte, 2048)
-			_, err = r.Read(data)
+			_, err = io.ReadFull(r, data)
 			if err != nil {
 				return err
 			}
@@ -156,7 +271,7 @@ func (client *Client) readSkyLight(r io.ReadCloser, column *Column, primaryBitMa
 	for cy := 0; cy < 16; cy++ {
 		if primaryBitMap&(1<<uint(cy)) != 0 {
 			data := make([]byte, 2048)
-			_, err = r.Read(data)
+			_, err = io.ReadFull(r, data)
 			if err != nil {
 				return err
 			}
@@ -178,7 +293,7 @@ func (client *Client) readAddTypes(r io.ReadCloser, column *Column, addBitMap ui
 	for cy := 0; cy < 16; cy++ {
 		if addBitMap&(1<<uint(cy)) != 0 {
 			data := make([]byte, 2048)
-			_, err = r.Read(data)
+			_, err = io.ReadFull(r, data)
 			if err != nil {
 				return err
 			}
@@ -198,7 +313,7 @@ func (client *Client) readAddTypes(r io.ReadCloser, column *Column, addBitMap ui
 
 func (client *Client) readBiomeData(r io.ReadCloser, column *Column) (err error) {
 	data := make([]byte, 256)
-	_, err = r.Read(data)
+	_, err = io.ReadFull(r, data)
 	if err != nil {
 		return err
 	}
@@ -206,3 +321,38 @@ func (client *Client) readBiomeData(r io.ReadCloser, column *Column) (err error)
 	column.Biomes = data
 	return nil
 }
+
+// Sky light arrays of sections lit entirely by the sky share this array.
+var fullSkyLight = bytes.Repeat([]byte{0xFF}, 2048)
+
+// Reduces the memory used by a newly-read chunk, which must not yet be shared: arrays of
+// zeroes are dropped, and sky light that is full everywhere shares one array. It returns
+// nil if nothing is left, meaning the chunk is empty air and can be left out of its
+// column.
+func compactChunk(chunk *Chunk) (result *Chunk) {
+	chunk.BlockTypes = nilIfZero(chunk.BlockTypes)
+	chunk.BlockMetadata = nilIfZero(chunk.BlockMetadata)
+	chunk.BlockLight = nilIfZero(chunk.BlockLight)
+	chunk.SkyLight = nilIfZero(chunk.SkyLight)
+	chunk.AddTypes = nilIfZero(chunk.AddTypes)
+
+	if chunk.SkyLight != nil && bytes.Equal(chunk.SkyLight, fullSkyLight) {
+		chunk.SkyLight = fullSkyLight
+	}
+
+	if chunk.BlockTypes == nil && chunk.BlockMetadata == nil && chunk.BlockLight == nil && chunk.SkyLight == nil && chunk.AddTypes == nil {
+		return nil
+	}
+
+	return chunk
+}
+
+func nilIfZero(data []byte) (result []byte) {
+	for _, b := range data {
+		if b != 0 {
+			return data
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,218 @@
+package mcclient
+
+import (
+	"math"
+)
+
+// The default for Client.TurnRate, in degrees per tick.
+const DefaultTurnRate = 30
+
+// The vanilla client sends the player's position at least this often, in ticks, even if
+// they have not moved.
+const positionResendTicks = 20
+
+// Entity action IDs for packet 0x13.
+const (
+	actionCrouch      = 1
+	actionUncrouch    = 2
+	actionStartSprint = 4
+	actionStopSprint  = 5
+)
+
+// Turns the player to look at a point, such as an entity's eyes or the centre of a block.
+// The player turns by at most TurnRate degrees per tick, starting with the next tick.
+func (client *Client) LookAt(x float64, y float64, z float64) {
+	client.playerMutex.Lock()
+	defer client.playerMutex.Unlock()
+
+	client.lookYaw, client.lookPitch = LookAngles(client.PlayerX, client.PlayerY+EyeHeight, client.PlayerZ, x, y, z)
+	client.looking = true
+}
+
+// Turns the player to look at the centre of a block.
+func (client *Client) LookAtBlock(coord BlockCoord) {
+	client.LookAt(float64(coord.X)+0.5, float64(coord.Y)+0.5, float64(coord.Z)+0.5)
+}
+
+// Reports whether the player is still turning towards the point given to LookAt.
+func (client *Client) Turning() (turning bool) {
+	client.playerMutex.Lock()
+	defer client.playerMutex.Unlock()
+
+	return client.looking
+}
+
+// Starts walking the player in a straight line towards a point, facing the way they walk
+// and jumping up steps, until they are within 0.3 blocks of it. The physics simulation
+// must be enabled. Calling LookAt afterwards makes the player look elsewhere while
+// walking.
+func (client *Client) WalkTowards(x float64, z float64) {
+	client.playerMutex.Lock()
+	defer client.playerMutex.Unlock()
+
+	client.walkX, client.walkZ = x, z
+	client.walking = true
+
+	client.lookYaw, _ = LookAngles(client.PlayerX, 0, client.PlayerZ, x, 0, z)
+	client.lookPitch = 0
+	client.looking = true
+}
+
+// Stops walking towards the point given to WalkTowards.
+func (client *Client) StopWalking() {
+	client.playerMutex.Lock()
+	client.walking = false
+	client.playerMutex.Unlock()
+}
+
+// Reports whether the player is still walking towards the point given to WalkTowards.
+func (client *Client) Walking() (walking bool) {
+	client.playerMutex.Lock()
+	defer client.playerMutex.Unlock()
+
+	return client.walking
+}
+
+// Makes the player jump, or swim upwards, as soon as they are on the ground or in a
+// liquid.
+func (client *Client) Jump() {
+	client.playerMutex.Lock()
+	client.jumping = true
+	client.playerMutex.Unlock()
+}
+
+// Starts or stops sneaking.
+func (client *Client) Sneak(sneak bool) (err error) {
+	client.playerMutex.Lock()
+	changed := client.sneaking != sneak
+	client.sneaking = sneak
+	client.playerMutex.Unlock()
+
+	if !changed {
+		return nil
+	}
+
+	if sneak {
+		return client.SendPacket(0x13, client.entityID, int8(actionCrouch))
+	}
+
+	return client.SendPacket(0x13, client.entityID, int8(actionUncrouch))
+}
+
+// Starts or stops sprinting. Sprinting only speeds the player up while they move forwards.
+func (client *Client) Sprint(sprint bool) (err error) {
+	client.playerMutex.Lock()
+	changed := client.sprinting != sprint
+	client.sprinting = sprint
+	client.playerMutex.Unlock()
+
+	if !changed {
+		return nil
+	}
+
+	if sprint {
+		return client.SendPacket(0x13, client.entityID, int8(actionStartSprint))
+	}
+
+	return client.SendPacket(0x13, client.entityID, int8(actionStopSprint))
+}
+
+// Turns the player towards their look target for this tick. The caller must hold
+// playerMutex.
+func (client *Client) turn() {
+	if client.looking {
+		client.PlayerYaw = turnTowards(client.PlayerYaw, client.lookYaw, client.TurnRate)
+		client.PlayerPitch = turnTowards(client.PlayerPitch, client.lookPitch, client.TurnRate)
+		client.looking = client.PlayerYaw != client.lookYaw || client.PlayerPitch != client.lookPitch
+	}
+}
+
+// Returns the input given to SetInput combined with that from the controller methods. The
+// caller must hold playerMutex.
+func (client *Client) controlInput() (input Input) {
+	input = client.input
+	input.Sneak = input.Sneak || client.sneaking
+	input.Sprint = input.Sprint || client.sprinting
+	input.Jump = input.Jump || client.jumping
+
+	if client.walking {
+		dx, dz := client.walkX-client.PlayerX, client.walkZ-client.PlayerZ
+		distance := math.Hypot(dx, dz)
+
+		if distance < 0.3 {
+			client.walking = false
+
+		} else {
+			// Walk in the direction of the target relative to where the player is facing,
+			// slowing down as they get close so as not to overshoot.
+			yaw, _ := LookAngles(0, 0, 0, dx, 0, dz)
+			relative := float64(yaw-client.PlayerYaw) * math.Pi / 180
+			speed := math.Min(1, distance)
+
+			input.Forward = math.Cos(relative) * speed
+			input.Strafe = -math.Sin(relative) * speed
+			input.AutoJump = true
+		}
+	}
+
+	return input
+}
+
+// Sends the packet describing the player's movement this tick: 0x0D if they have moved
+// and turned, 0x0B if they have only moved, 0x0C if they have only turned, and 0x0A
+// otherwise. The caller must hold playerMutex.
+func (client *Client) sendMovement() (err error) {
+	client.ticksSincePosition++
+
+	moved := client.PlayerX != client.sentX || client.PlayerY != client.sentY || client.PlayerZ != client.sentZ ||
+		client.PlayerStance != client.sentStance || client.ticksSincePosition >= positionResendTicks
+	turned := client.PlayerYaw != client.sentYaw || client.PlayerPitch != client.sentPitch
+
+	switch {
+	case moved && turned:
+		err = client.SendPacket(0x0D, client.PlayerX, client.PlayerY, client.PlayerStance, client.PlayerZ, client.PlayerYaw, client.PlayerPitch, client.PlayerOnGround)
+	case moved:
+		err = client.SendPacket(0x0B, client.PlayerX, client.PlayerY, client.PlayerStance, client.PlayerZ, client.PlayerOnGround)
+	case turned:
+		err = client.SendPacket(0x0C, client.PlayerYaw, client.PlayerPitch, client.PlayerOnGround)
+	default:
+		err = client.SendPacket(0x0A, client.PlayerOnGround)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	client.sentMovement(moved, turned)
+	return nil
+}
+
+// Records what the server has been told of the player's position and look. The caller
+// must hold playerMutex.
+func (client *Client) sentMovement(moved bool, turned bool) {
+	if moved {
+		client.sentX, client.sentY, client.sentZ = client.PlayerX, client.PlayerY, client.PlayerZ
+		client.sentStance = client.PlayerStance
+		client.ticksSincePosition = 0
+	}
+
+	if turned {
+		client.sentYaw, client.sentPitch = client.PlayerYaw, client.PlayerPitch
+	}
+}
+
+// Returns angle turned towards target by at most rate degrees, the short way round. A
+// rate of 0 or less turns all the way at once.
+func turnTowards(angle float32, target float32, rate float32) (result float32) {
+	delta := float32(math.Remainder(float64(target-angle), 360))
+
+	if rate <= 0 || (delta <= rate && delta >= -rate) {
+		return target
+	}
+
+	if delta > 0 {
+		return angle + rate
+	}
+
+	return angle - rate
+}
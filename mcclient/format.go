@@ -0,0 +1,341 @@
+package mcclient
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"strings"
+)
+
+// The character that starts a colour or formatting escape in chat messages, signs and
+// server descriptions. It is followed by one of the characters 0-9 and a-f (a colour),
+// k-o (a formatting code) or r (reset).
+const EscapeChar = '§'
+
+// One of the 16 chat colours, numbered as in escapes.
+type Colour int8
+
+const (
+	Black Colour = iota
+	DarkBlue
+	DarkGreen
+	DarkAqua
+	DarkRed
+	DarkPurple
+	Gold
+	Gray
+	DarkGray
+	Blue
+	Green
+	Aqua
+	Red
+	LightPurple
+	Yellow
+	White
+)
+
+// The colour of text not preceded by a colour escape, which is up to the client.
+const DefaultColour Colour = -1
+
+var colourNames = [16]string{"black", "dark_blue", "dark_green", "dark_aqua", "dark_red", "dark_purple", "gold", "gray",
+	"dark_gray", "blue", "green", "aqua", "red", "light_purple", "yellow", "white"}
+
+var colourRGBs = [16]uint32{0x000000, 0x0000AA, 0x00AA00, 0x00AAAA, 0xAA0000, 0xAA00AA, 0xFFAA00, 0xAAAAAA,
+	0x555555, 0x5555FF, 0x55FF55, 0x55FFFF, 0xFF5555, 0xFF55FF, 0xFFFF55, 0xFFFFFF}
+
+// The nearest colours in the xterm 256-colour palette.
+var colourANSIs = [16]int{16, 19, 34, 37, 124, 127, 214, 248, 240, 63, 83, 87, 203, 207, 227, 231}
+
+// Returns the colour's name as used in the game's JSON text, e.g. "dark_red".
+func (colour Colour) String() (name string) {
+	if colour < 0 || colour > White {
+		return "default"
+	}
+
+	return colourNames[colour]
+}
+
+// Returns the character identifying the colour in escapes.
+func (colour Colour) Code() (code rune) {
+	return rune("0123456789abcdef"[colour&15])
+}
+
+// Returns the colour as 0xRRGGBB, or 0xFFFFFF for the default colour.
+func (colour Colour) RGB() (rgb uint32) {
+	if colour < 0 || colour > White {
+		return 0xFFFFFF
+	}
+
+	return colourRGBs[colour]
+}
+
+// Returns the colour identified by a character in an escape.
+func ColourByCode(code rune) (colour Colour, ok bool) {
+	switch {
+	case code >= '0' && code <= '9':
+		return Colour(code - '0'), true
+	case code >= 'a' && code <= 'f':
+		return Colour(code-'a') + 10, true
+	case code >= 'A' && code <= 'F':
+		return Colour(code-'A') + 10, true
+	}
+
+	return DefaultColour, false
+}
+
+// A run of text with the same colour and formatting.
+type Span struct {
+	Text          string
+	Colour        Colour
+	Bold          bool
+	Italic        bool
+	Underline     bool
+	Strikethrough bool
+	Obfuscated    bool // Shown as random characters that change constantly.
+}
+
+// Reports whether two spans have the same colour and formatting.
+func (span Span) SameStyle(other Span) (same bool) {
+	other.Text = span.Text
+	return span == other
+}
+
+// Splits a string containing escapes into spans. As in the game, a colour escape also
+// turns off formatting, and an escape with an unknown code, or an escape at the end of
+// the string, is removed.
+func ParseFormatted(input string) (spans []Span) {
+	style := Span{Colour: DefaultColour}
+	text := new(bytes.Buffer)
+	escaped := false
+
+	flush := func() {
+		if text.Len() > 0 {
+			style.Text = text.String()
+			spans = append(spans, style)
+			text.Reset()
+		}
+	}
+
+	for _, c := range input {
+		if !escaped {
+			if c == EscapeChar {
+				escaped = true
+			} else {
+				text.WriteRune(c)
+			}
+
+			continue
+		}
+
+		escaped = false
+		next := style
+
+		if colour, ok := ColourByCode(c); ok {
+			next = Span{Colour: colour}
+
+		} else {
+			switch c {
+			case 'k', 'K':
+				next.Obfuscated = true
+			case 'l', 'L':
+				next.Bold = true
+			case 'm', 'M':
+				next.Strikethrough = true
+			case 'n', 'N':
+				next.Underline = true
+			case 'o', 'O':
+				next.Italic = true
+			case 'r', 'R':
+				next = Span{Colour: DefaultColour}
+			}
+		}
+
+		if !next.SameStyle(style) {
+			flush()
+			style = next
+		}
+	}
+
+	flush()
+	return spans
+}
+
+// Joins spans into a string with escapes, for sending in chat messages or on signs.
+func FormatSpans(spans []Span) (output string) {
+	buffer := new(bytes.Buffer)
+	style := Span{Colour: DefaultColour}
+
+	for _, span := range spans {
+		if span.Text == "" {
+			continue
+		}
+
+		if !span.SameStyle(style) {
+			// Formatting can only be turned off by a colour or reset escape, which turn off
+			// all of it, so only formatting being added can be written on its own.
+			if span.Colour != style.Colour || (style.Bold && !span.Bold) || (style.Italic && !span.Italic) ||
+				(style.Underline && !span.Underline) || (style.Strikethrough && !span.Strikethrough) || (style.Obfuscated && !span.Obfuscated) {
+
+				buffer.WriteRune(EscapeChar)
+				if span.Colour == DefaultColour {
+					buffer.WriteRune('r')
+				} else {
+					buffer.WriteRune(span.Colour.Code())
+				}
+
+				style = Span{Colour: span.Colour}
+			}
+
+			writeFormatEscape(buffer, span.Obfuscated && !style.Obfuscated, 'k')
+			writeFormatEscape(buffer, span.Bold && !style.Bold, 'l')
+			writeFormatEscape(buffer, span.Strikethrough && !style.Strikethrough, 'm')
+			writeFormatEscape(buffer, span.Underline && !style.Underline, 'n')
+			writeFormatEscape(buffer, span.Italic && !style.Italic, 'o')
+
+			style = span
+		}
+
+		buffer.WriteString(span.Text)
+	}
+
+	return buffer.String()
+}
+
+func writeFormatEscape(buffer *bytes.Buffer, write bool, code rune) {
+	if write {
+		buffer.WriteRune(EscapeChar)
+		buffer.WriteRune(code)
+	}
+}
+
+// Returns the text of spans without any formatting.
+func PlainText(spans []Span) (output string) {
+	buffer := new(bytes.Buffer)
+
+	for _, span := range spans {
+		buffer.WriteString(span.Text)
+	}
+
+	return buffer.String()
+}
+
+// Renders spans with ANSI escape sequences for a terminal supporting 256 colours.
+// Obfuscated text is shown as it is.
+func ANSIText(spans []Span) (output string) {
+	buffer := new(bytes.Buffer)
+
+	for _, span := range spans {
+		buffer.WriteString("\x1b[0")
+
+		if span.Bold {
+			buffer.WriteString(";1")
+		}
+		if span.Italic {
+			buffer.WriteString(";3")
+		}
+		if span.Underline {
+			buffer.WriteString(";4")
+		}
+		if span.Strikethrough {
+			buffer.WriteString(";9")
+		}
+		if span.Colour >= 0 && span.Colour <= White {
+			fmt.Fprintf(buffer, ";38;5;%d", colourANSIs[span.Colour])
+		}
+
+		buffer.WriteString("m")
+		buffer.WriteString(span.Text)
+	}
+
+	if len(spans) > 0 {
+		buffer.WriteString("\x1b[0m")
+	}
+
+	return buffer.String()
+}
+
+// Renders spans as HTML, with inline styles. Obfuscated text is given the class
+// "obfuscated" so that it can be hidden or animated.
+func HTMLText(spans []Span) (output string) {
+	buffer := new(bytes.Buffer)
+
+	for _, span := range spans {
+		var styles []string
+
+		if span.Colour >= 0 && span.Colour <= White {
+			styles = append(styles, fmt.Sprintf("color: #%06X", span.Colour.RGB()))
+		}
+		if span.Bold {
+			styles = append(styles, "font-weight: bold")
+		}
+		if span.Italic {
+			styles = append(styles, "font-style: italic")
+		}
+
+		switch {
+		case span.Underline && span.Strikethrough:
+			styles = append(styles, "text-decoration: underline line-through")
+		case span.Underline:
+			styles = append(styles, "text-decoration: underline")
+		case span.Strikethrough:
+			styles = append(styles, "text-decoration: line-through")
+		}
+
+		text := html.EscapeString(span.Text)
+
+		if len(styles) == 0 && !span.Obfuscated {
+			buffer.WriteString(text)
+			continue
+		}
+
+		buffer.WriteString("<span")
+		if span.Obfuscated {
+			buffer.WriteString(` class="obfuscated"`)
+		}
+		if len(styles) > 0 {
+			fmt.Fprintf(buffer, ` style="%s"`, strings.Join(styles, "; "))
+		}
+		fmt.Fprintf(buffer, ">%s</span>", text)
+	}
+
+	return buffer.String()
+}
+
+var markdownEscaper = strings.NewReplacer(`\`, `\\`, "`", "\\`", `*`, `\*`, `_`, `\_`, `~`, `\~`, `[`, `\[`, `]`, `\]`,
+	`#`, `\#`, `<`, `\<`, `>`, `\>`, `|`, `\|`)
+
+// Renders spans as Markdown. Bold, italic and strikethrough text is marked up; colours,
+// underlining and obfuscation cannot be expressed and are dropped.
+func MarkdownText(spans []Span) (output string) {
+	buffer := new(bytes.Buffer)
+
+	for _, span := range spans {
+		opening, closing := "", ""
+		for _, m := range []struct {
+			on     bool
+			marker string
+		}{{span.Bold, "**"}, {span.Italic, "*"}, {span.Strikethrough, "~~"}} {
+			if m.on {
+				opening, closing = opening+m.marker, m.marker+closing
+			}
+		}
+
+		text := markdownEscaper.Replace(span.Text)
+		trimmed := strings.TrimSpace(text)
+
+		if opening == "" || trimmed == "" {
+			buffer.WriteString(text)
+			continue
+		}
+
+		// Emphasis markers must be next to the text they enclose, so surrounding spaces are
+		// moved outside them.
+		start := strings.Index(text, trimmed)
+
+		buffer.WriteString(text[:start])
+		buffer.WriteString(opening + trimmed + closing)
+		buffer.WriteString(text[start+len(trimmed):])
+	}
+
+	return buffer.String()
+}
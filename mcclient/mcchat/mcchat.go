@@ -1,13 +1,67 @@
 package main
 
 import (
-	"bufio"
+	"flag"
 	"fmt"
 	"github.com/kierdavis/mc/mcclient"
 	"io"
 	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
 )
 
+var (
+	debugP   = flag.Bool("debug", false, "Whether to show debug messages.")
+	logP     = flag.String("log", "", "A file to write debug messages to, whether or not they are shown.")
+	historyP = flag.String("history", defaultHistoryFile(), "The file to keep the history of lines typed in. Pass an empty string to not keep it.")
+	chatlogP = flag.String("chatlog", "", "A directory to log chat messages in. Use 'mcchat search' to search the logs.")
+)
+
+func defaultHistoryFile() (filename string) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+
+	return filepath.Join(home, ".mcchat_history")
+}
+
+// Shows debug messages above the prompt once the line editor is running, and writes them
+// to the log file.
+type debugWriter struct {
+	mutex  sync.Mutex
+	show   bool
+	log    io.Writer
+	editor *lineEditor
+}
+
+func (w *debugWriter) Write(s []byte) (n int, err error) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if w.log != nil {
+		w.log.Write(s)
+	}
+
+	if w.show {
+		if w.editor != nil {
+			w.editor.Print("\x1b[2m" + strings.TrimRight(string(s), "\n") + "\x1b[0m")
+		} else {
+			os.Stdout.Write(s)
+		}
+	}
+
+	return len(s), nil
+}
+
+func (w *debugWriter) setEditor(editor *lineEditor) {
+	w.mutex.Lock()
+	w.editor = editor
+	w.mutex.Unlock()
+}
+
 func main() {
 	/*
 		defer func() {
@@ -21,19 +75,47 @@ func main() {
 		}()
 	*/
 
-	if len(os.Args) < 2 {
-		fmt.Printf("Not enough arguments\n\nusage: %s <server address>\n\nThis program expects the MC_USER and MC_PASSWD environment variables to be set. Otherwise, the user is logged in with an offline account.\n", os.Args[0])
+	if len(os.Args) > 1 && os.Args[1] == "search" {
+		os.Exit(search(os.Args[2:]))
+	}
+
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: %s [options] <server address>\n       %s search [options] [text]\n\nThis program expects the MC_USER and MC_PASSWD environment variables to be set. Otherwise, the user is logged in with an offline account.\n\n", os.Args[0], os.Args[0])
+		flag.PrintDefaults()
+	}
+
+	flag.Parse()
+
+	if flag.NArg() < 1 {
+		fmt.Printf("Not enough arguments\n\n")
+		flag.Usage()
 		os.Exit(2)
 	}
 
 	fmt.Printf("*** Welcome to mcchat!\n")
 
-	addr := os.Args[1]
+	addr := flag.Arg(0)
 	username := os.Getenv("MC_USER")
 	password := os.Getenv("MC_PASSWD")
 
-	var debugWriter io.Writer
-	debugWriter = os.Stdout
+	var debug *debugWriter
+	var dw io.Writer
+
+	if *debugP || *logP != "" {
+		debug = &debugWriter{show: *debugP}
+		dw = debug
+
+		if *logP != "" {
+			f, err := os.OpenFile(*logP, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+			if err != nil {
+				fmt.Printf("Error: %s\n", err.Error())
+				os.Exit(1)
+			}
+
+			defer f.Close()
+			debug.log = f
+		}
+	}
 
 	fmt.Printf("*** Logging in...\n")
 
@@ -45,29 +127,51 @@ func main() {
 			username = "Player"
 		}
 
-		client = mcclient.LoginOffline(username, debugWriter)
+		client = mcclient.LoginOffline(username, dw)
 
 	} else {
-		client, err = mcclient.Login(username, password, debugWriter)
+		client, err = mcclient.Login(username, password, dw)
+		if err != nil {
+			fmt.Printf("Error: %s\n", err.Error())
+			os.Exit(1)
+		}
+	}
+
+	// Set once the line editor is running.
+	var editor *lineEditor
+	var editorMutex sync.Mutex
+
+	printf := func(format string, args ...interface{}) {
+		editorMutex.Lock()
+		defer editorMutex.Unlock()
+
+		if editor != nil {
+			editor.Print(fmt.Sprintf(format, args...))
+		} else {
+			fmt.Printf(format+"\n", args...)
+		}
+	}
+
+	if *chatlogP != "" {
+		logger, err := mcclient.NewChatLogger(*chatlogP)
 		if err != nil {
 			fmt.Printf("Error: %s\n", err.Error())
 			os.Exit(1)
 		}
+
+		defer logger.Close()
+		logger.Attach(client)
 	}
 
 	go func() {
 		err := <-client.ErrChan
 		if err != nil {
-			fmt.Printf("Error: %s\n", err.Error())
+			printf("Error: %s", err.Error())
 			client.Leave()
 			client.Logout()
 		}
 	}()
 
-	client.HandleMessage = func(msg string) {
-		fmt.Printf("\r%s\n>", mcclient.ANSIEscapes(msg))
-	}
-
 	fmt.Printf("*** Connecting to %s...\n", addr)
 
 	err = client.Join(addr)
@@ -77,18 +181,52 @@ func main() {
 		os.Exit(1)
 	}
 
-	fmt.Printf("*** Connected!\n*** Type & press enter to send messages!\n*** Press Ctrl+D to exit\n\n")
+	restore, err := setRawMode()
+	if err != nil {
+		fmt.Printf("*** Could not set up the terminal, so line editing is not available: %s\n", err.Error())
+	} else {
+		defer restore()
+	}
 
-	go func() {
-		stdinReader := bufio.NewReader(os.Stdin)
+	e := newLineEditor("> ", err == nil, func(line string) []string {
+		completions, err := client.TabComplete(line)
+		if err != nil {
+			return nil
+		}
+
+		return completions
+	})
+
+	e.historyFile = *historyP
+	if e.historyFile != "" {
+		err = e.LoadHistory()
+		if err != nil && !os.IsNotExist(err) {
+			fmt.Printf("*** Could not load history: %s\n", err.Error())
+		}
+	}
 
-		fmt.Printf(">")
+	client.HandleMessage = func(msg string) {
+		e.Print(mcclient.ANSIEscapes(msg))
+	}
+
+	fmt.Printf("*** Connected!\n*** Type & press enter to send messages!\n*** Press Tab to complete commands and player names, and Up and Down for history\n*** Press Ctrl+D to exit\n\n")
+
+	editorMutex.Lock()
+	editor = e
+	editorMutex.Unlock()
+
+	if debug != nil {
+		debug.setEditor(e)
+	}
+
+	go updateStatus(client, e)
 
+	go func() {
 		for {
-			msg, err := stdinReader.ReadString('\n')
+			msg, err := e.ReadLine()
 			if err != nil {
 				if err != io.EOF {
-					fmt.Printf("Error: %s\n", err.Error())
+					e.Print(fmt.Sprintf("Error: %s", err.Error()))
 				}
 
 				client.Leave()
@@ -96,13 +234,36 @@ func main() {
 				return
 			}
 
-			fmt.Printf("\x1b[1T>")
-			client.Chat(msg[:len(msg)-1])
+			err = client.Chat(msg)
+			if err != nil {
+				e.Print(fmt.Sprintf("Error: %s", err.Error()))
+			}
 		}
 	}()
 
 	kickmsg := client.Run()
 	if kickmsg != "" {
-		fmt.Printf("\nKicked: %s\n", kickmsg)
+		e.Print(fmt.Sprintf("Kicked: %s", kickmsg))
+	}
+
+	e.Close()
+}
+
+// Keeps the status line up to date with the player's health, food and position, and the
+// players online.
+func updateStatus(client *mcclient.Client, editor *lineEditor) {
+	for {
+		health, food, _ := client.Health()
+		x, y, z := client.Position()
+
+		var names []string
+		for _, player := range client.OnlinePlayers() {
+			names = append(names, mcclient.NoEscapes(player.Name))
+		}
+
+		editor.SetStatus(fmt.Sprintf(" Health %d/20 | Food %d/20 | %.0f, %.0f, %.0f | %d online: %s",
+			health, food, x, y, z, len(names), strings.Join(names, ", ")))
+
+		time.Sleep(time.Second)
 	}
 }
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/kierdavis/mc/mcclient"
+	"os"
+	"strings"
+	"time"
+)
+
+var timeLayouts = []string{
+	"2006-01-02",
+	"2006-01-02 15:04",
+	"2006-01-02 15:04:05",
+	time.RFC3339,
+}
+
+// Parses a time given on the command line, either as a date and time in local time or
+// as a duration before now, e.g. "2h".
+func parseTime(s string) (t time.Time, err error) {
+	d, err := time.ParseDuration(s)
+	if err == nil {
+		return time.Now().Add(-d), nil
+	}
+
+	for _, layout := range timeLayouts {
+		t, err = time.ParseInLocation(layout, s, time.Local)
+		if err == nil {
+			return t, nil
+		}
+	}
+
+	return time.Time{}, fmt.Errorf("Invalid time '%s'; expected e.g. '2006-01-02 15:04' or '2h'", s)
+}
+
+// Runs "mcchat search", which prints the chat messages in logs written by -chatlog.
+func search(args []string) (status int) {
+	flags := flag.NewFlagSet("search", flag.ExitOnError)
+	dir := flags.String("dir", ".", "The directory the logs are in.")
+	player := flags.String("player", "", "Only show messages sent by or to this player.")
+	since := flags.String("since", "", "Only show messages sent at or after this time.")
+	until := flags.String("until", "", "Only show messages sent before this time.")
+	asJSON := flags.Bool("json", false, "Print the messages as JSON lines.")
+
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: %s search [options] [text]\n\nPrints the logged chat messages containing the text. Times may be given as '2006-01-02 15:04', or as a duration before now such as '2h'.\n\n", os.Args[0])
+		flags.PrintDefaults()
+	}
+
+	flags.Parse(args)
+
+	query := mcclient.ChatLogQuery{
+		Player: *player,
+		Text:   strings.Join(flags.Args(), " "),
+	}
+
+	var err error
+
+	if *since != "" {
+		query.Since, err = parseTime(*since)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %s\n", err.Error())
+			return 2
+		}
+	}
+
+	if *until != "" {
+		query.Until, err = parseTime(*until)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %s\n", err.Error())
+			return 2
+		}
+	}
+
+	entries, err := mcclient.SearchChatLogs(*dir, query, os.Stderr)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err.Error())
+		return 1
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetEscapeHTML(false)
+
+	for _, entry := range entries {
+		if *asJSON {
+			encoder.Encode(entry)
+		} else {
+			fmt.Printf("%s [%s] %s\n", entry.Time.Local().Format("2006-01-02 15:04:05"), entry.Type, entry.Text)
+		}
+	}
+
+	if len(entries) == 0 {
+		return 1
+	}
+
+	return 0
+}
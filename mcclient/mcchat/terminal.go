@@ -0,0 +1,518 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// How many lines of input history are kept.
+const maxHistory = 1000
+
+// Turns off line buffering, echoing and signal keys on the terminal, so that keys are
+// read as they are pressed, returning a function that restores the previous settings.
+func setRawMode() (restore func(), err error) {
+	saved, err := stty("-g")
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = stty("-icanon", "-echo", "-isig", "-ixon", "min", "1")
+	if err != nil {
+		return nil, err
+	}
+
+	return func() {
+		stty(strings.TrimSpace(saved))
+	}, nil
+}
+
+// Returns the width of the terminal, or 80 if it is not known.
+func terminalWidth() (width int) {
+	size, err := stty("size")
+	if err == nil {
+		var rows int
+		_, err = fmt.Sscan(size, &rows, &width)
+	}
+
+	if err != nil || width <= 0 {
+		return 80
+	}
+
+	return width
+}
+
+func stty(args ...string) (output string, err error) {
+	cmd := exec.Command("stty", args...)
+	cmd.Stdin = os.Stdin
+
+	out, err := cmd.Output()
+	return string(out), err
+}
+
+// Reads lines typed at the terminal, below a status line, while other output scrolls up
+// above them.
+//
+// Keys: Left/Right, Home/End (or Ctrl+A/Ctrl+E) move the cursor; Up/Down recall history;
+// Backspace/Delete remove characters; Ctrl+U/Ctrl+K delete to the start/end of the line;
+// Ctrl+W deletes the previous word; Tab completes; Ctrl+C clears the line, or quits if it
+// is empty, as does Ctrl+D.
+type lineEditor struct {
+	prompt   string
+	in       *bufio.Reader
+	out      io.Writer
+	raw      bool
+	width    int
+	complete func(line string) (completions []string)
+
+	// If not empty, lines read are appended to this file, and it is loaded by
+	// LoadHistory.
+	historyFile string
+
+	mutex   sync.Mutex
+	line    []rune
+	cursor  int
+	status  string
+	history []string
+	recall  int    // The index in history of the line being shown, or len(history).
+	draft   []rune // The line being typed before recalling history.
+	drawn   bool   // Whether the status line and prompt are on screen.
+	closed  bool
+}
+
+// Creates an editor reading from stdin. If raw is false the terminal does the editing,
+// and Tab completion and history are not available.
+func newLineEditor(prompt string, raw bool, complete func(string) []string) (editor *lineEditor) {
+	return &lineEditor{
+		prompt:   prompt,
+		in:       bufio.NewReader(os.Stdin),
+		out:      os.Stdout,
+		raw:      raw,
+		width:    terminalWidth(),
+		complete: complete,
+	}
+}
+
+// Reads the history file.
+func (editor *lineEditor) LoadHistory() (err error) {
+	f, err := os.Open(editor.historyFile)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	editor.mutex.Lock()
+	defer editor.mutex.Unlock()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		editor.addHistory(scanner.Text())
+	}
+
+	return scanner.Err()
+}
+
+// Adds a line to the history, unless it is empty or the same as the last line. The
+// caller must hold mutex.
+func (editor *lineEditor) addHistory(line string) (added bool) {
+	if line == "" || (len(editor.history) > 0 && editor.history[len(editor.history)-1] == line) {
+		return false
+	}
+
+	editor.history = append(editor.history, line)
+	if len(editor.history) > maxHistory {
+		editor.history = editor.history[len(editor.history)-maxHistory:]
+	}
+
+	return true
+}
+
+// Appends a line to the history file.
+func (editor *lineEditor) saveHistory(line string) (err error) {
+	f, err := os.OpenFile(editor.historyFile, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = fmt.Fprintln(f, line)
+	return err
+}
+
+// Prints output above the status line.
+func (editor *lineEditor) Print(s string) {
+	editor.mutex.Lock()
+	defer editor.mutex.Unlock()
+
+	editor.clear()
+	io.WriteString(editor.out, s+"\n")
+	editor.redraw()
+}
+
+// Changes the status line.
+func (editor *lineEditor) SetStatus(status string) {
+	editor.mutex.Lock()
+	defer editor.mutex.Unlock()
+
+	if status == editor.status {
+		return
+	}
+
+	editor.clear()
+	editor.status = status
+	editor.redraw()
+}
+
+// Removes the status line and prompt for good; later output is printed plainly.
+func (editor *lineEditor) Close() {
+	editor.mutex.Lock()
+	defer editor.mutex.Unlock()
+
+	editor.clear()
+	editor.closed = true
+}
+
+// Removes the status line and prompt from the screen, leaving the cursor at the start of
+// the status line. The caller must hold mutex.
+func (editor *lineEditor) clear() {
+	if !editor.drawn {
+		return
+	}
+
+	if editor.status != "" {
+		io.WriteString(editor.out, "\r\x1b[K\x1b[1A")
+	}
+
+	io.WriteString(editor.out, "\r\x1b[K")
+	editor.drawn = false
+}
+
+// Draws the status line and prompt, scrolling the line to keep the cursor on screen. The
+// caller must hold mutex.
+func (editor *lineEditor) redraw() {
+	if editor.drawn {
+		editor.clear()
+	}
+
+	if editor.closed {
+		return
+	}
+
+	if editor.status != "" {
+		fmt.Fprintf(editor.out, "\x1b[7m%s\x1b[0m\n", truncate(editor.status, editor.width-1))
+	}
+
+	avail := editor.width - len([]rune(editor.prompt)) - 1
+	if avail < 1 {
+		avail = 1
+	}
+
+	start := 0
+	if editor.cursor > avail {
+		start = editor.cursor - avail
+	}
+
+	end := start + avail
+	if end > len(editor.line) {
+		end = len(editor.line)
+	}
+
+	io.WriteString(editor.out, editor.prompt+string(editor.line[start:end]))
+	if back := end - editor.cursor; back > 0 {
+		fmt.Fprintf(editor.out, "\x1b[%dD", back)
+	}
+
+	editor.drawn = true
+}
+
+// Returns s cut to at most width characters.
+func truncate(s string, width int) (truncated string) {
+	runes := []rune(s)
+	if width < 0 || len(runes) <= width {
+		return s
+	}
+
+	return string(runes[:width])
+}
+
+// Reads the next line typed, returning io.EOF if Ctrl+D or Ctrl+C is pressed on an empty
+// line.
+func (editor *lineEditor) ReadLine() (line string, err error) {
+	editor.mutex.Lock()
+	editor.line, editor.cursor = nil, 0
+	editor.recall, editor.draft = len(editor.history), nil
+	editor.redraw()
+	editor.mutex.Unlock()
+
+	if !editor.raw {
+		line, err = editor.in.ReadString('\n')
+
+		editor.mutex.Lock()
+		editor.drawn = false
+		editor.mutex.Unlock()
+
+		return strings.TrimRight(line, "\r\n"), err
+	}
+
+	for {
+		c, _, err := editor.in.ReadRune()
+		if err != nil {
+			return "", err
+		}
+
+		if c == '\t' {
+			editor.tabComplete()
+			continue
+		}
+
+		// The rest of an escape sequence is read before taking the mutex, so that a lone
+		// Esc does not stop Print while waiting for the next key.
+		if c == 27 {
+			final, params, ok := editor.readEscape()
+			if ok {
+				editor.mutex.Lock()
+				editor.escape(final, params)
+				editor.redraw()
+				editor.mutex.Unlock()
+			}
+
+			continue
+		}
+
+		editor.mutex.Lock()
+		line, done, added, err := editor.key(c)
+
+		if done {
+			editor.line, editor.cursor = nil, 0
+			editor.redraw()
+			editor.mutex.Unlock()
+
+			if added && editor.historyFile != "" {
+				editor.saveHistory(line)
+			}
+
+			return line, err
+		}
+
+		editor.redraw()
+		editor.mutex.Unlock()
+	}
+}
+
+// Handles a key press, returning done when the line is finished, and whether it was added
+// to the history. The caller must hold mutex.
+func (editor *lineEditor) key(c rune) (line string, done bool, added bool, err error) {
+	switch c {
+	case '\r', '\n':
+		line = string(editor.line)
+		return line, true, editor.addHistory(line), nil
+
+	case 3: // Ctrl+C
+		if len(editor.line) == 0 {
+			return "", true, false, io.EOF
+		}
+
+		editor.line, editor.cursor = nil, 0
+
+	case 4: // Ctrl+D
+		if len(editor.line) == 0 {
+			return "", true, false, io.EOF
+		}
+
+		editor.delete(editor.cursor, editor.cursor+1)
+
+	case 1: // Ctrl+A
+		editor.cursor = 0
+
+	case 5: // Ctrl+E
+		editor.cursor = len(editor.line)
+
+	case 2: // Ctrl+B
+		editor.move(-1)
+
+	case 6: // Ctrl+F
+		editor.move(1)
+
+	case 11: // Ctrl+K
+		editor.delete(editor.cursor, len(editor.line))
+
+	case 21: // Ctrl+U
+		editor.delete(0, editor.cursor)
+
+	case 23: // Ctrl+W
+		start := editor.cursor
+		for start > 0 && editor.line[start-1] == ' ' {
+			start--
+		}
+		for start > 0 && editor.line[start-1] != ' ' {
+			start--
+		}
+
+		editor.delete(start, editor.cursor)
+
+	case 127, 8: // Backspace
+		if editor.cursor > 0 {
+			editor.delete(editor.cursor-1, editor.cursor)
+		}
+
+	default:
+		if unicode.IsPrint(c) {
+			editor.line = append(editor.line[:editor.cursor], append([]rune{c}, editor.line[editor.cursor:]...)...)
+			editor.cursor++
+		}
+	}
+
+	return "", false, false, nil
+}
+
+// Reads the rest of an escape sequence after the Esc, returning its final character and
+// parameters. It returns false for anything other than a CSI or SS3 sequence.
+func (editor *lineEditor) readEscape() (final rune, params string, ok bool) {
+	c, _, err := editor.in.ReadRune()
+	if err != nil || (c != '[' && c != 'O') {
+		return 0, "", false
+	}
+
+	var p []rune
+
+	for {
+		c, _, err = editor.in.ReadRune()
+		if err != nil {
+			return 0, "", false
+		}
+
+		if c >= 0x40 && c <= 0x7E {
+			return c, string(p), true
+		}
+
+		p = append(p, c)
+	}
+}
+
+// Handles an escape sequence, such as an arrow key. The caller must hold mutex.
+func (editor *lineEditor) escape(final rune, params string) {
+	switch {
+	case final == 'A':
+		editor.recallHistory(-1)
+	case final == 'B':
+		editor.recallHistory(1)
+	case final == 'C':
+		editor.move(1)
+	case final == 'D':
+		editor.move(-1)
+	case final == 'H' || (final == '~' && (params == "1" || params == "7")):
+		editor.cursor = 0
+	case final == 'F' || (final == '~' && (params == "4" || params == "8")):
+		editor.cursor = len(editor.line)
+	case final == '~' && params == "3": // Delete
+		editor.delete(editor.cursor, editor.cursor+1)
+	}
+}
+
+// Moves the cursor. The caller must hold mutex.
+func (editor *lineEditor) move(offset int) {
+	editor.cursor += offset
+
+	if editor.cursor < 0 {
+		editor.cursor = 0
+	} else if editor.cursor > len(editor.line) {
+		editor.cursor = len(editor.line)
+	}
+}
+
+// Removes the characters between two positions in the line. The caller must hold mutex.
+func (editor *lineEditor) delete(start int, end int) {
+	if end > len(editor.line) {
+		end = len(editor.line)
+	}
+
+	if start >= end {
+		return
+	}
+
+	editor.line = append(editor.line[:start], editor.line[end:]...)
+	editor.cursor = start
+}
+
+// Replaces the line with an earlier or later one from the history. The caller must hold
+// mutex.
+func (editor *lineEditor) recallHistory(offset int) {
+	recall := editor.recall + offset
+	if recall < 0 || recall > len(editor.history) {
+		return
+	}
+
+	if editor.recall == len(editor.history) {
+		editor.draft = editor.line
+	}
+
+	editor.recall = recall
+
+	if recall == len(editor.history) {
+		editor.line = editor.draft
+	} else {
+		editor.line = []rune(editor.history[recall])
+	}
+
+	editor.cursor = len(editor.line)
+}
+
+// Completes the word before the cursor. If there are several completions, their common
+// prefix is inserted and they are listed above the status line.
+func (editor *lineEditor) tabComplete() {
+	if editor.complete == nil {
+		return
+	}
+
+	editor.mutex.Lock()
+	before := string(editor.line[:editor.cursor])
+	after := string(editor.line[editor.cursor:])
+	editor.mutex.Unlock()
+
+	completions := editor.complete(before)
+	if len(completions) == 0 {
+		return
+	}
+
+	start := strings.LastIndex(before, " ") + 1
+	word := commonPrefix(completions)
+
+	if len(completions) > 1 {
+		editor.Print(strings.Join(completions, "  "))
+	} else {
+		word += " "
+	}
+
+	editor.mutex.Lock()
+	defer editor.mutex.Unlock()
+
+	// Only complete if the line has not changed in the meantime.
+	if string(editor.line) == before+after && len(word) >= len(before)-start {
+		completed := []rune(before[:start] + word)
+		editor.line = append(completed, []rune(after)...)
+		editor.cursor = len(completed)
+		editor.redraw()
+	}
+}
+
+// Returns the longest prefix shared by a list of strings, ignoring case, using the case
+// of the first.
+func commonPrefix(strs []string) (prefix string) {
+	prefix = strs[0]
+
+	for _, s := range strs[1:] {
+		n := 0
+		for n < len(prefix) && n < len(s) && unicode.ToLower(rune(prefix[n])) == unicode.ToLower(rune(s[n])) {
+			n++
+		}
+
+		prefix = prefix[:n]
+	}
+
+	return prefix
+}
@@ -5,7 +5,7 @@ import (
 	"fmt"
 	"io"
 	"net"
-	"strings"
+	"sync"
 	"time"
 )
 
@@ -39,18 +39,27 @@ type ExplosionRecord struct {
 	Z int8
 }
 
+// Dumps the bytes read from and written to a connection to the client's DebugWriter,
+// while its PacketLogging is set.
 type LogReadWriter struct {
-	inner io.ReadWriter
+	inner  io.ReadWriter
+	client *Client
 }
 
 func (lrw LogReadWriter) Read(data []byte) (n int, err error) {
 	n, err = lrw.inner.Read(data)
-	fmt.Printf("R %X\n", data[:n])
+	if lrw.client.PacketLogging && lrw.client.DebugWriter != nil {
+		fmt.Fprintf(lrw.client.DebugWriter, "R %X\n", data[:n])
+	}
+
 	return n, err
 }
 
 func (lrw LogReadWriter) Write(data []byte) (n int, err error) {
-	fmt.Printf("W %X\n", data)
+	if lrw.client.PacketLogging && lrw.client.DebugWriter != nil {
+		fmt.Fprintf(lrw.client.DebugWriter, "W %X\n", data)
+	}
+
 	return lrw.inner.Write(data)
 }
 
@@ -59,8 +68,18 @@ type Client struct {
 	DebugWriter   io.Writer
 	PacketLogging bool
 	HandleMessage func(string)
+	ChatParser    *ChatParser // Classifies chat messages before they are passed to OnChat handlers.
 	StoreWorld    bool
-	Columns       map[ColumnCoord]*Column
+	World         *World
+
+	// How many chat messages ChatSender may send per second on average, and in a burst;
+	// a ChatRate of 0 means no limit. These should be set before joining a server.
+	ChatRate  float64
+	ChatBurst int
+
+	// If set, colour escapes in outgoing chat are kept, for servers that allow them.
+	// Otherwise they are removed, as vanilla servers kick players who send them.
+	ChatEscapes bool
 
 	PlayerX        float64
 	PlayerY        float64
@@ -69,12 +88,71 @@ type Client struct {
 	PlayerYaw      float32
 	PlayerPitch    float32
 	PlayerOnGround bool
+	PlayerVelX     float64
+	PlayerVelY     float64
+	PlayerVelZ     float64
+
+	PlayerHealth     int16 // Out of 20.
+	PlayerFood       int16 // Out of 20.
+	PlayerSaturation float32
+
+	// If set, PositionSender moves the player with the physics simulation each tick before
+	// sending their position; see PhysicsTick and SetInput. The player's fields must then
+	// only be accessed through the methods that lock playerMutex.
+	Physics bool
+
+	// The most the player's yaw and pitch may change by each tick when turning to look at
+	// something, in degrees; 0 for no limit. See LookAt.
+	TurnRate float32
+
+	input                Input
+	collidedHorizontally bool
+	playerMutex          sync.Mutex
+
+	lookYaw   float32
+	lookPitch float32
+	looking   bool
+	walkX     float64
+	walkZ     float64
+	walking   bool
+	jumping   bool
+	sneaking  bool
+	sprinting bool
+
+	// What the server was last told of the player's position and look.
+	sentX              float64
+	sentY              float64
+	sentZ              float64
+	sentStance         float64
+	sentYaw            float32
+	sentPitch          float32
+	ticksSincePosition int
+
+	sendMutex sync.Mutex
+
+	chatQueue      []string
+	chatQueueMutex sync.Mutex
+	chatReady      chan struct{}
+
+	tabCompleteReply      chan string
+	tabCompleteMutex      sync.Mutex // Held for the whole of a request.
+	tabCompleteLate       int        // Replies still to come for requests that timed out.
+	tabCompleteReplyMutex sync.Mutex // Guards tabCompleteLate.
+
+	players     map[int32]*PlayerEntity
+	playerList  map[string]int16 // Ping times of the players in the player list.
+	entityMutex sync.Mutex       // Guards players and playerList.
+
+	chatHandlers      []chatHandler
+	nextChatHandlerID int
+	chatMutex         sync.Mutex
 
 	netConn net.Conn
 	conn    io.ReadWriter
 
 	stopHTTPKeepAlive  Signal
 	stopPositionSender Signal
+	stopChatSender     Signal
 
 	username              string
 	sessionId             string
@@ -100,9 +178,16 @@ func newClient(username string, sessionId string, debugWriter io.Writer) (client
 		ErrChan:            make(chan error),
 		DebugWriter:        debugWriter,
 		PacketLogging:      false,
-		Columns:            make(map[ColumnCoord]*Column),
+		World:              NewWorld(),
+		TurnRate:           DefaultTurnRate,
+		ChatParser:         NewChatParser(username),
+		ChatRate:           DefaultChatRate,
+		ChatBurst:          DefaultChatBurst,
+		chatReady:          make(chan struct{}, 1),
+		tabCompleteReply:   make(chan string, 1),
 		stopHTTPKeepAlive:  make(Signal),
 		stopPositionSender: make(Signal),
+		stopChatSender:     make(Signal),
 		username:           username,
 		sessionId:          sessionId,
 	}
@@ -114,80 +199,10 @@ func newClient(username string, sessionId string, debugWriter io.Writer) (client
 
 // Removes Minecraft colour escapes.
 func NoEscapes(input string) (output string) {
-	start := 0
-
-	for {
-		end := strings.Index(input[start:], "\xC2\xA7")
-		if end < 0 {
-			break
-		}
-
-		end += start
-		output += input[start:end]
-		start = end + 3
-	}
-
-	output += input[start:]
-	return output
+	return PlainText(ParseFormatted(input))
 }
 
-// Converts Minecraft colour escapes to ANSI escape codes for printing in a terminal.
+// Replaces Minecraft colour escapes with ANSI escape sequences.
 func ANSIEscapes(input string) (output string) {
-	start := 0
-
-	for {
-		end := strings.Index(input[start:], "\xC2\xA7")
-		if end < 0 {
-			break
-		}
-
-		end += start
-		output += input[start:end]
-
-		switch input[end+2] {
-		case '0':
-			output += "\x1b[21m\x1b[30m"
-		case '1':
-			output += "\x1b[21m\x1b[34m"
-		case '2':
-			output += "\x1b[21m\x1b[32m"
-		case '3':
-			output += "\x1b[21m\x1b[36m"
-		case '4':
-			output += "\x1b[21m\x1b[31m"
-		case '5':
-			output += "\x1b[21m\x1b[35m"
-		case '6':
-			output += "\x1b[21m\x1b[33m"
-		case '7':
-			output += "\x1b[21m\x1b[37m"
-		case '8':
-			output += "\x1b[1m\x1b[30m"
-		case '9':
-			output += "\x1b[1m\x1b[34m"
-		case 'a', 'A':
-			output += "\x1b[1m\x1b[32m"
-		case 'b', 'B':
-			output += "\x1b[1m\x1b[36m"
-		case 'c', 'C':
-			output += "\x1b[1m\x1b[31m"
-		case 'd', 'D':
-			output += "\x1b[1m\x1b[35m"
-		case 'e', 'E':
-			output += "\x1b[1m\x1b[33m"
-		case 'f', 'F':
-			output += "\x1b[1m\x1b[37m"
-		}
-
-		start = end + 3
-	}
-
-	output += input[start:] + "\x1b[21m\x1b[39m"
-
-	return output
-}
-
-// Sends a chat message
-func (client *Client) Chat(msg string) (err error) {
-	return client.SendPacket(0x03, msg)
+	return ANSIText(ParseFormatted(input))
 }
@@ -2,7 +2,9 @@ package mcclient
 
 import (
 	"compress/zlib"
+	"encoding/binary"
 	"fmt"
+	"io"
 )
 
 func (client *Client) handleKeepAlivePacket() (err error) {
@@ -33,6 +35,8 @@ func (client *Client) handleChatMessagePacket() (err error) {
 		client.HandleMessage(msg)
 	}
 
+	client.dispatchChat(msg)
+
 	return nil
 }
 
@@ -67,9 +71,11 @@ func (client *Client) handleSpawnPositionPacket() (err error) {
 		return err
 	}
 
+	client.playerMutex.Lock()
 	client.PlayerX = float64(x)
 	client.PlayerY = float64(y)
 	client.PlayerZ = float64(z)
+	client.playerMutex.Unlock()
 
 	return nil
 }
@@ -83,6 +89,10 @@ func (client *Client) handleUpdateHealthPacket() (err error) {
 		return err
 	}
 
+	client.playerMutex.Lock()
+	client.PlayerHealth, client.PlayerFood, client.PlayerSaturation = health, food, foodSat
+	client.playerMutex.Unlock()
+
 	return nil
 }
 
@@ -97,10 +107,19 @@ func (client *Client) handleRespawnPacket() (err error) {
 		return err
 	}
 
+	// Entities in the old world are not destroyed individually.
+	client.forgetEntities(nil)
+
 	return nil
 }
 
 func (client *Client) handlePlayerPositionLookPacket() (err error) {
+	client.playerMutex.Lock()
+	defer client.playerMutex.Unlock()
+
+	// The server has moved the player, so any momentum is lost.
+	client.PlayerVelX, client.PlayerVelY, client.PlayerVelZ = 0, 0, 0
+
 	err = client.RecvPacketData(&client.PlayerX, &client.PlayerStance, &client.PlayerY, &client.PlayerZ, &client.PlayerYaw, &client.PlayerPitch, &client.PlayerOnGround)
 	if err != nil {
 		return err
@@ -115,6 +134,8 @@ func (client *Client) handlePlayerPositionLookPacket() (err error) {
 		return err
 	}
 
+	client.sentMovement(true, true)
+
 	return nil
 }
 
@@ -153,6 +174,13 @@ func (client *Client) handleSpawnNamedEntityPacket() (err error) {
 		return err
 	}
 
+	_, err = client.RecvEntityMetadata()
+	if err != nil {
+		return err
+	}
+
+	client.spawnPlayer(entityId, playerName, x, y, z, yaw, pitch)
+
 	return nil
 }
 
@@ -254,13 +282,23 @@ func (client *Client) handleEntityVelocityPacket() (err error) {
 }
 
 func (client *Client) handleDestroyEntityPacket() (err error) {
-	var entityId int32
+	var count uint8
 
-	err = client.RecvPacketData(&entityId)
+	err = client.RecvPacketData(&count)
 	if err != nil {
 		return err
 	}
 
+	entityIds := make([]int32, count)
+	for i := range entityIds {
+		err = client.RecvPacketData(&entityIds[i])
+		if err != nil {
+			return err
+		}
+	}
+
+	client.forgetEntities(entityIds)
+
 	return nil
 }
 
@@ -284,6 +322,8 @@ func (client *Client) handleEntityRelativeMovePacket() (err error) {
 		return err
 	}
 
+	client.movePlayer(entityId, dx, dy, dz)
+
 	return nil
 }
 
@@ -296,6 +336,8 @@ func (client *Client) handleEntityLookPacket() (err error) {
 		return err
 	}
 
+	client.turnPlayer(entityId, yaw, pitch)
+
 	return nil
 }
 
@@ -308,6 +350,9 @@ func (client *Client) handleEntityLookRelativeMovePacket() (err error) {
 		return err
 	}
 
+	client.movePlayer(entityId, dx, dy, dz)
+	client.turnPlayer(entityId, yaw, pitch)
+
 	return nil
 }
 
@@ -320,6 +365,9 @@ func (client *Client) handleEntityTeleportPacket() (err error) {
 		return err
 	}
 
+	client.teleportPlayer(entityId, x, y, z)
+	client.turnPlayer(entityId, yaw, pitch)
+
 	return nil
 }
 
@@ -424,10 +472,13 @@ func (client *Client) handleMapColumnAllocationPacket() (err error) {
 		coord := ColumnCoord{int(cx), int(cz)}
 
 		if initialize {
-			client.Columns[coord] = &Column{Chunks: make(map[int]*Chunk)}
+			client.World.SetColumn(coord, &Column{Chunks: make(map[int]*Chunk)})
 
 		} else {
-			delete(client.Columns, coord)
+			err = client.World.UnloadColumn(coord)
+			if err != nil {
+				return err
+			}
 		}
 	}
 
@@ -446,12 +497,26 @@ func (client *Client) handleMapChunksPacket() (err error) {
 
 	if client.StoreWorld {
 		coord := ColumnCoord{int(cx), int(cz)}
-		column, ok := client.Columns[coord]
+		stored, ok := client.World.GetColumn(coord)
 
 		if !ok {
 			return fmt.Errorf("Receiving chunks into an unloaded column at (%d, %d)", cx, cz)
 		}
 
+		// The stored column may be in use by other goroutines, so the chunks are read into
+		// a new one which then replaces it. A ground-up continuous update replaces every
+		// chunk in the column.
+		column := &Column{Chunks: make(map[int]*Chunk), Biomes: stored.Biomes}
+		if !groundUpContinuous {
+			column = stored.copy()
+		}
+
+		for cy := 0; cy < 16; cy++ {
+			if primaryBitMap&(1<<uint(cy)) != 0 {
+				column.Chunks[cy] = new(Chunk)
+			}
+		}
+
 		//r := flate.NewReader(client.conn)
 		r, err := zlib.NewReader(client.conn)
 		if err != nil {
@@ -492,8 +557,23 @@ func (client *Client) handleMapChunksPacket() (err error) {
 			}
 		}
 
+		for cy := 0; cy < 16; cy++ {
+			if primaryBitMap&(1<<uint(cy)) != 0 {
+				if compactChunk(column.Chunks[cy]) == nil {
+					delete(column.Chunks, cy)
+				}
+			}
+		}
+
+		client.World.SetColumn(coord, column)
+
+		err = client.World.Evict(client.playerColumn())
+		if err != nil {
+			return err
+		}
+
 	} else {
-		_, err = client.conn.Read(make([]byte, compressedSize))
+		_, err = io.ReadFull(client.conn, make([]byte, compressedSize))
 		if err != nil {
 			return err
 		}
@@ -512,23 +592,52 @@ func (client *Client) handleMultiBlockChangePacket() (err error) {
 	}
 
 	data := make([]byte, dataSize)
-	_, err = client.conn.Read(data)
+	_, err = io.ReadFull(client.conn, data)
 	if err != nil {
 		return err
 	}
 
+	if client.StoreWorld {
+		if int(recordCount)*4 > len(data) {
+			return fmt.Errorf("Multi block change has %d records in %d bytes", recordCount, len(data))
+		}
+
+		changes := make([]BlockChange, recordCount)
+
+		// Each record packs the position within the column, the block ID and the metadata
+		// into 32 bits.
+		for i := range changes {
+			record := binary.BigEndian.Uint32(data[i*4:])
+
+			changes[i] = BlockChange{
+				X:        int(cx)*16 + int(record>>28),
+				Y:        int(record >> 16 & 0xFF),
+				Z:        int(cz)*16 + int(record>>24&0x0F),
+				ID:       uint16(record >> 4 & 0x0FFF),
+				Metadata: byte(record & 0x0F),
+			}
+		}
+
+		client.World.SetBlocks(changes)
+	}
+
 	return nil
 }
 
 func (client *Client) handleBlockChangePacket() (err error) {
 	var x, z int32
-	var y, blockType, blockMetadata int8
+	var y, blockMetadata uint8
+	var blockType uint16
 
 	err = client.RecvPacketData(&x, &y, &z, &blockType, &blockMetadata)
 	if err != nil {
 		return err
 	}
 
+	if client.StoreWorld {
+		client.World.SetBlock(int(x), int(y), int(z), Block{ID: blockType, Metadata: blockMetadata})
+	}
+
 	return nil
 }
 
@@ -764,6 +873,8 @@ func (client *Client) handlePlayerListItemPacket() (err error) {
 		return err
 	}
 
+	client.listPlayer(playerName, online, ping)
+
 	return nil
 }
 
@@ -778,6 +889,32 @@ func (client *Client) handlePlayerAbilitiesPacket() (err error) {
 	return nil
 }
 
+func (client *Client) handleTabCompletePacket() (err error) {
+	var completions string
+
+	err = client.RecvPacketData(&completions)
+	if err != nil {
+		return err
+	}
+
+	client.tabCompleteReplyMutex.Lock()
+	defer client.tabCompleteReplyMutex.Unlock()
+
+	// The server answers requests in order, so the replies to requests that timed out come
+	// first. Those, and replies nobody is waiting for, are dropped.
+	if client.tabCompleteLate > 0 {
+		client.tabCompleteLate--
+		return nil
+	}
+
+	select {
+	case client.tabCompleteReply <- completions:
+	default:
+	}
+
+	return nil
+}
+
 func (client *Client) handlePluginMessagePacket() (err error) {
 	var channel string
 	var length int16
@@ -30,6 +30,7 @@ func serializeRecvFields(fields []interface{}) (s string) {
 }
 
 // Sends a packet on the channel. The types of the fields are determined by runtime reflection.
+// It is safe to call from several goroutines at once.
 func (client *Client) SendPacket(id byte, fields ...interface{}) (err error) {
 	if client.PacketLogging {
 		fmt.Fprintf(client.DebugWriter, "-> 0x%02X %s\n", id, serializeSendFields(fields))
@@ -106,6 +107,9 @@ func (client *Client) SendPacket(id byte, fields ...interface{}) (err error) {
 		}
 	}
 
+	client.sendMutex.Lock()
+	defer client.sendMutex.Unlock()
+
 	_, err = client.conn.Write(buffer.Bytes())
 	if err != nil {
 		return err
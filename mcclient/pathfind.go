@@ -0,0 +1,514 @@
+package mcclient
+
+import (
+	"container/heap"
+	"fmt"
+	"github.com/kierdavis/mc/resources"
+	"math"
+	"time"
+)
+
+// The highest drop that does not hurt the player.
+const SafeDrop = 3
+
+// Returned by WalkPath when it is cancelled.
+var ErrCancelled = fmt.Errorf("Cancelled")
+
+// Options for FindPath and WalkPath. The zero value finds walking routes only.
+type PathOptions struct {
+	MaxDrop  int // The highest the player may drop, in blocks. Defaults to SafeDrop.
+	MaxNodes int // How many positions to explore before giving up. Defaults to 20000.
+	Range    int // How close to the goal the path must end, in blocks. Defaults to 0.
+
+	// If positive, paths may break solid blocks in the way, adding this cost per block to
+	// the cost of the move. Walking one block costs 1.
+	BreakCost float64
+
+	// If positive, paths may place a block to stand on where there is none, at this extra
+	// cost. The block placed is whatever the player is holding.
+	PlaceCost float64
+
+	Timeout time.Duration // How long WalkPath may take. Defaults to one minute.
+
+	// If not nil, WalkPath stops and returns ErrCancelled once Cancel is closed.
+	Cancel <-chan struct{}
+}
+
+// A step along a path.
+type Waypoint struct {
+	BlockCoord              // The block the player's feet move into.
+	Break      []BlockCoord // Blocks to break before moving.
+	Place      bool         // Place a block under the waypoint before moving.
+}
+
+type pathNode struct {
+	waypoint Waypoint
+	cost     float64 // The cost of the best path found to the node so far.
+	estimate float64 // cost plus the estimated cost to the goal.
+	parent   *pathNode
+	index    int // Position in the open heap, or -1 once closed.
+}
+
+type pathHeap []*pathNode
+
+func (h pathHeap) Len() int           { return len(h) }
+func (h pathHeap) Less(i, j int) bool { return h[i].estimate < h[j].estimate }
+func (h pathHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *pathHeap) Push(x interface{}) {
+	node := x.(*pathNode)
+	node.index = len(*h)
+	*h = append(*h, node)
+}
+
+func (h *pathHeap) Pop() interface{} {
+	old := *h
+	node := old[len(old)-1]
+	node.index = -1
+	*h = old[:len(old)-1]
+	return node
+}
+
+func (options *PathOptions) withDefaults() (result PathOptions) {
+	if options != nil {
+		result = *options
+	}
+
+	if result.MaxDrop <= 0 {
+		result.MaxDrop = SafeDrop
+	}
+
+	if result.MaxNodes <= 0 {
+		result.MaxNodes = 20000
+	}
+
+	if result.Timeout <= 0 {
+		result.Timeout = time.Minute
+	}
+
+	return result
+}
+
+// Finds the cheapest walkable route for the player's feet from start to goal with the A*
+// algorithm, returning the waypoints after start. Routes move between horizontally
+// adjacent blocks, stepping up at most one block at a time and dropping at most
+// MaxDrop, and never pass through liquids or dangerous blocks.
+func (snapshot *Snapshot) FindPath(start BlockCoord, goal BlockCoord, options *PathOptions) (path []Waypoint, err error) {
+	opts := options.withDefaults()
+	rangeSq := opts.Range * opts.Range
+
+	startNode := &pathNode{waypoint: Waypoint{BlockCoord: start}}
+	startNode.estimate = pathEstimate(start, goal)
+
+	nodes := map[BlockCoord]*pathNode{start: startNode}
+	open := &pathHeap{startNode}
+	explored := 0
+
+	for open.Len() > 0 {
+		node := heap.Pop(open).(*pathNode)
+
+		if node.waypoint.DistanceSq(goal) <= rangeSq {
+			for ; node.parent != nil; node = node.parent {
+				path = append(path, node.waypoint)
+			}
+
+			// The path was built from the end backwards.
+			for i, j := 0, len(path)-1; i < j; i, j = i+1, j-1 {
+				path[i], path[j] = path[j], path[i]
+			}
+
+			return path, nil
+		}
+
+		explored++
+		if explored > opts.MaxNodes {
+			break
+		}
+
+		for _, move := range snapshot.pathMoves(node.waypoint.BlockCoord, &opts) {
+			cost := node.cost + move.cost
+
+			next, ok := nodes[move.waypoint.BlockCoord]
+			if ok && cost >= next.cost {
+				continue
+			}
+
+			if !ok {
+				next = &pathNode{index: -1}
+				nodes[move.waypoint.BlockCoord] = next
+			}
+
+			next.waypoint = move.waypoint
+			next.cost = cost
+			next.estimate = cost + pathEstimate(move.waypoint.BlockCoord, goal)
+			next.parent = node
+
+			if next.index >= 0 {
+				heap.Fix(open, next.index)
+			} else {
+				heap.Push(open, next)
+			}
+		}
+	}
+
+	return nil, fmt.Errorf("No path from (%d, %d, %d) to (%d, %d, %d)", start.X, start.Y, start.Z, goal.X, goal.Y, goal.Z)
+}
+
+// Finds a path from the player's position to goal.
+func (client *Client) FindPath(goal BlockCoord, options *PathOptions) (path []Waypoint, err error) {
+	return client.World.Snapshot().FindPath(BlockCoordAt(client.Position()), goal, options)
+}
+
+// A lower bound on the cost of a path between two positions.
+func pathEstimate(from BlockCoord, to BlockCoord) (estimate float64) {
+	return math.Abs(float64(to.X-from.X)) + math.Abs(float64(to.Z-from.Z)) + 0.5*math.Abs(float64(to.Y-from.Y))
+}
+
+type pathMove struct {
+	waypoint Waypoint
+	cost     float64
+}
+
+var pathDirections = [4]BlockCoord{{1, 0, 0}, {-1, 0, 0}, {0, 0, 1}, {0, 0, -1}}
+
+// Returns the moves that can be made from a position where the player is standing.
+func (snapshot *Snapshot) pathMoves(from BlockCoord, opts *PathOptions) (moves []pathMove) {
+	for _, d := range pathDirections {
+		to := BlockCoord{from.X + d.X, from.Y, from.Z + d.Z}
+
+		// Walking on the level, or stepping off an edge.
+		if breaks, ok := snapshot.clearance(to, opts); ok {
+			cost := 1 + float64(len(breaks))*opts.BreakCost
+			below := BlockCoord{to.X, to.Y - 1, to.Z}
+
+			if snapshot.standable(below) {
+				moves = append(moves, pathMove{Waypoint{to, breaks, false}, cost})
+
+			} else if len(breaks) == 0 {
+				if landing, ok := snapshot.landing(to, opts.MaxDrop); ok {
+					drop := float64(to.Y - landing.Y)
+					moves = append(moves, pathMove{Waypoint{BlockCoord: landing}, cost + 0.5*drop})
+				}
+
+				if opts.PlaceCost > 0 && snapshot.isBlock(below, resources.Replaceable) && !snapshot.isBlock(below, resources.Liquid) {
+					moves = append(moves, pathMove{Waypoint{to, nil, true}, cost + opts.PlaceCost})
+				}
+			}
+		}
+
+		// Jumping up a block, which needs room above the player's head.
+		up := BlockCoord{to.X, to.Y + 1, to.Z}
+
+		if snapshot.passable(BlockCoord{from.X, from.Y + 2, from.Z}) && snapshot.standable(to) {
+			if breaks, ok := snapshot.clearance(up, opts); ok {
+				moves = append(moves, pathMove{Waypoint{up, breaks, false}, 2 + float64(len(breaks))*opts.BreakCost})
+			}
+		}
+	}
+
+	return moves
+}
+
+// Reports whether the player's feet and head fit at a position, returning the blocks
+// that must be broken first.
+func (snapshot *Snapshot) clearance(feet BlockCoord, opts *PathOptions) (breaks []BlockCoord, ok bool) {
+	for _, coord := range []BlockCoord{feet, {feet.X, feet.Y + 1, feet.Z}} {
+		if snapshot.passable(coord) {
+			continue
+		}
+
+		if opts.BreakCost <= 0 || !snapshot.breakable(coord) {
+			return nil, false
+		}
+
+		breaks = append(breaks, coord)
+	}
+
+	return breaks, true
+}
+
+// Returns where the player lands when falling from a position, if the drop is no further
+// than maxDrop and passes through nothing but air.
+func (snapshot *Snapshot) landing(from BlockCoord, maxDrop int) (landing BlockCoord, ok bool) {
+	for drop := 1; drop <= maxDrop; drop++ {
+		feet := BlockCoord{from.X, from.Y - drop, from.Z}
+
+		if !snapshot.passable(feet) {
+			return BlockCoord{}, false
+		}
+
+		if snapshot.standable(BlockCoord{feet.X, feet.Y - 1, feet.Z}) {
+			return feet, true
+		}
+	}
+
+	return BlockCoord{}, false
+}
+
+// Reports whether every waypoint of a path can still be moved through, given the blocks
+// it expects to break and place.
+func (snapshot *Snapshot) pathValid(path []Waypoint) (valid bool) {
+	for _, w := range path {
+		breaking := make(map[BlockCoord]bool)
+		for _, coord := range w.Break {
+			breaking[coord] = true
+		}
+
+		for _, coord := range []BlockCoord{w.BlockCoord, {w.X, w.Y + 1, w.Z}} {
+			if !snapshot.passable(coord) && !(breaking[coord] && snapshot.breakable(coord)) {
+				return false
+			}
+		}
+
+		// The floor must still be there, or still have room for the block to be placed.
+		below := BlockCoord{w.X, w.Y - 1, w.Z}
+
+		if w.Place {
+			if !snapshot.isBlock(below, resources.Replaceable) || snapshot.isBlock(below, resources.Liquid) {
+				return false
+			}
+
+		} else if !snapshot.standable(below) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (snapshot *Snapshot) passable(coord BlockCoord) (passable bool) {
+	block, ok := snapshot.GetBlock(coord.X, coord.Y, coord.Z)
+	return ok && !block.Is(resources.Solid|resources.Liquid|resources.Dangerous)
+}
+
+func (snapshot *Snapshot) standable(coord BlockCoord) (standable bool) {
+	block, ok := snapshot.GetBlock(coord.X, coord.Y, coord.Z)
+	return ok && block.Is(resources.Solid) && !block.Is(resources.Dangerous)
+}
+
+func (snapshot *Snapshot) breakable(coord BlockCoord) (breakable bool) {
+	block, ok := snapshot.GetBlock(coord.X, coord.Y, coord.Z)
+	if !ok || !block.Is(resources.Solid) || block.Is(resources.Dangerous) {
+		return false
+	}
+
+	_, ok = resources.BlockBreakTicks(block.ID)
+	return ok
+}
+
+func (snapshot *Snapshot) isBlock(coord BlockCoord, categories resources.BlockCategory) (is bool) {
+	block, ok := snapshot.GetBlock(coord.X, coord.Y, coord.Z)
+	return ok && block.Is(categories)
+}
+
+// Walks the player to goal along a path found with FindPath, breaking and placing blocks
+// on the way if the options allow it. The player is steered with WalkTowards, so Physics
+// and StoreWorld must be set. Whenever the stored world changes, for example when a block
+// change packet arrives, the rest of the path is checked and a new path is found if it is
+// blocked; a new path is also found if the player gets stuck.
+func (client *Client) WalkPath(goal BlockCoord, options *PathOptions) (err error) {
+	opts := options.withDefaults()
+	deadline := time.Now().Add(opts.Timeout)
+
+	ticker := time.NewTicker(Tick)
+	defer ticker.Stop()
+
+	defer client.StopWalking()
+
+	for time.Now().Before(deadline) {
+		generation := client.World.Generation()
+
+		path, err := client.FindPath(goal, &opts)
+		if err != nil {
+			return err
+		}
+
+		if len(path) == 0 {
+			return nil
+		}
+
+		from := BlockCoordAt(client.Position())
+		stuck := 0
+
+	follow:
+		for len(path) > 0 {
+			if time.Now().After(deadline) {
+				break
+			}
+
+			select {
+			case <-opts.Cancel:
+				return ErrCancelled
+			default:
+			}
+
+			if g := client.World.Generation(); g != generation {
+				generation = g
+				if !client.World.Snapshot().pathValid(path) {
+					break follow
+				}
+			}
+
+			w := &path[0]
+
+			if len(w.Break) > 0 {
+				client.StopWalking()
+
+				err = client.digBlock(w.Break[0], ticker, opts.Cancel)
+				if err != nil {
+					return err
+				}
+
+				if !client.waitForBlock(w.Break[0], Block.IsAir, ticker) {
+					break follow
+				}
+
+				w.Break = w.Break[1:]
+				continue
+			}
+
+			if w.Place {
+				client.StopWalking()
+
+				err = client.placeBlock(from, BlockCoord{w.X, w.Y - 1, w.Z})
+				if err != nil {
+					return err
+				}
+
+				if !client.waitForBlock(BlockCoord{w.X, w.Y - 1, w.Z}, isSolid, ticker) {
+					break follow
+				}
+
+				w.Place = false
+				continue
+			}
+
+			x, y, z := client.Position()
+			tx, tz := float64(w.X)+0.5, float64(w.Z)+0.5
+
+			if (tx-x)*(tx-x)+(tz-z)*(tz-z) < 0.3*0.3 && math.Abs(y-float64(w.Y)) < 0.6 && client.OnGround() {
+				from = w.BlockCoord
+				path = path[1:]
+				stuck = 0
+				continue
+			}
+
+			stuck++
+			if stuck > 3*20 {
+				break follow
+			}
+
+			client.WalkTowards(tx, tz)
+			if w.Y > floor(y) {
+				client.Jump()
+			}
+
+			<-ticker.C
+		}
+
+		if len(path) == 0 {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("Timed out walking to (%d, %d, %d)", goal.X, goal.Y, goal.Z)
+}
+
+// Waits up to five seconds for a block to match.
+func (client *Client) waitForBlock(coord BlockCoord, match func(Block) bool, ticker *time.Ticker) (ok bool) {
+	for i := 0; i < 5*20; i++ {
+		block, _ := client.GetBlock(coord.X, coord.Y, coord.Z)
+		if match(block) {
+			return true
+		}
+
+		<-ticker.C
+	}
+
+	return false
+}
+
+func isSolid(block Block) (solid bool) {
+	return block.Is(resources.Solid)
+}
+
+// Digs a block on the face the player can see. The server rejects a dig finished sooner
+// than the block takes to break, so this keeps digging for as long as breaking it by hand
+// takes, which is never too short whatever the player holds.
+func (client *Client) digBlock(coord BlockCoord, ticker *time.Ticker, cancel <-chan struct{}) (err error) {
+	block, _ := client.GetBlock(coord.X, coord.Y, coord.Z)
+	if block.IsAir() {
+		return nil
+	}
+
+	ticks, ok := resources.BlockBreakTicks(block.ID)
+	if !ok {
+		return fmt.Errorf("Cannot break block %d at (%d, %d, %d)", block.ID, coord.X, coord.Y, coord.Z)
+	}
+
+	face := client.visibleFace(coord)
+
+	client.SetLook(client.LookAnglesToBlock(coord))
+
+	err = client.SendPacket(0x0E, int8(0), int32(coord.X), uint8(coord.Y), int32(coord.Z), int8(face))
+	if err != nil {
+		return err
+	}
+
+	// One extra tick allows for the server counting from when the packet arrives.
+	for i := 0; i <= ticks; i++ {
+		select {
+		case <-cancel:
+			return ErrCancelled
+		case <-ticker.C:
+		}
+	}
+
+	return client.SendPacket(0x0E, int8(2), int32(coord.X), uint8(coord.Y), int32(coord.Z), int8(face))
+}
+
+// Sends the packet to place the held block at coord, against the block under the
+// player's feet at from, which must be next to it.
+func (client *Client) placeBlock(from BlockCoord, coord BlockCoord) (err error) {
+	against := BlockCoord{from.X, from.Y - 1, from.Z}
+
+	var face Face
+
+	switch {
+	case coord.X > against.X:
+		face = FaceEast
+	case coord.X < against.X:
+		face = FaceWest
+	case coord.Z > against.Z:
+		face = FaceSouth
+	default:
+		face = FaceNorth
+	}
+
+	client.SetLook(client.LookAnglesToBlock(coord))
+
+	// The held item is sent as an empty slot; the server uses its own record of it.
+	return client.SendPacket(0x0F, int32(against.X), uint8(against.Y), int32(against.Z), int8(face), int16(-1), int8(8), int8(8), int8(8))
+}
+
+// Returns the face of a block seen from the player's eyes, or the top face if the block
+// is hidden.
+func (client *Client) visibleFace(coord BlockCoord) (face Face) {
+	x, y, z := client.Position()
+	y += EyeHeight
+
+	dx := float64(coord.X) + 0.5 - x
+	dy := float64(coord.Y) + 0.5 - y
+	dz := float64(coord.Z) + 0.5 - z
+
+	hit, ok := client.World.Snapshot().RayCast(x, y, z, dx, dy, dz, Reach+1, nil)
+	if ok && hit.BlockCoord == coord {
+		return hit.Face
+	}
+
+	return FaceTop
+}
@@ -0,0 +1,73 @@
+package mcclient
+
+import (
+	"testing"
+)
+
+// Returns a world of one column with a stone floor at y = 4, leaving out the floor at
+// the given positions.
+func flatWorld(holes ...BlockCoord) (world *World) {
+	types := make([]byte, 4096)
+	for i := 4 << 8; i < 5<<8; i++ {
+		types[i] = 1
+	}
+
+	for _, hole := range holes {
+		types[hole.X|hole.Z<<4|hole.Y<<8] = 0
+	}
+
+	world = NewWorld()
+	world.SetColumn(ColumnCoord{0, 0}, &Column{Chunks: map[int]*Chunk{0: {BlockTypes: types}}})
+	return world
+}
+
+// A path must be found again when the floor under a later waypoint is broken.
+func TestPathInvalidWhenFloorRemoved(t *testing.T) {
+	world := flatWorld()
+
+	path, err := world.Snapshot().FindPath(BlockCoord{1, 5, 1}, BlockCoord{10, 5, 1}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !world.Snapshot().pathValid(path) {
+		t.Fatalf("New path is not valid")
+	}
+
+	w := path[len(path)-2]
+	world.SetBlock(w.X, w.Y-1, w.Z, Block{})
+
+	if world.Snapshot().pathValid(path) {
+		t.Errorf("Path is still valid with the floor at (%d, %d, %d) removed", w.X, w.Y-1, w.Z)
+	}
+}
+
+// A path that places a block must be found again when the gap fills with liquid.
+func TestPathInvalidWhenPlaceBlocked(t *testing.T) {
+	gap := BlockCoord{5, 4, 1}
+	world := flatWorld(gap)
+
+	path, err := world.Snapshot().FindPath(BlockCoord{1, 5, 1}, BlockCoord{10, 5, 1}, &PathOptions{PlaceCost: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	placing := false
+	for _, w := range path {
+		placing = placing || w.Place
+	}
+
+	if !placing {
+		t.Fatalf("Path does not place a block: %v", path)
+	}
+
+	if !world.Snapshot().pathValid(path) {
+		t.Fatalf("New path is not valid")
+	}
+
+	world.SetBlock(gap.X, gap.Y, gap.Z, Block{ID: 9})
+
+	if world.Snapshot().pathValid(path) {
+		t.Errorf("Path is still valid with water where the block is to be placed")
+	}
+}
@@ -0,0 +1,421 @@
+package mcclient
+
+import (
+	"github.com/kierdavis/mc/resources"
+	"math"
+)
+
+// Player dimensions and movement constants, per tick, as used by the vanilla client.
+const (
+	PlayerWidth  = 0.6
+	PlayerHeight = 1.8
+	StepHeight   = 0.5 // The highest ledge the player walks up without jumping.
+
+	Gravity      = 0.08
+	Drag         = 0.98 // Vertical velocity is multiplied by this each tick in air.
+	JumpVelocity = 0.42
+
+	groundSlipperiness = 0.6 * 0.91
+	airSlipperiness    = 0.91
+	groundAcceleration = 0.1 * 0.16277136 / (groundSlipperiness * groundSlipperiness * groundSlipperiness)
+	airAcceleration    = 0.02
+	sprintFactor       = 1.3
+	sneakFactor        = 0.3
+	sprintJumpBoost    = 0.2
+	ladderSpeed        = 0.15
+	ladderClimbSpeed   = 0.2
+)
+
+// The movement the physics simulation tries to make each tick, as if keys were held down.
+type Input struct {
+	Forward float64 // From -1 (backwards) to 1 (forwards), relative to PlayerYaw.
+	Strafe  float64 // From -1 (right) to 1 (left).
+	Jump    bool    // Jump when on the ground, swim upwards in liquids.
+	Sneak   bool
+	Sprint  bool
+
+	// Jump when walking into a block while on the ground, so that the player can climb
+	// one-block steps without checking for them.
+	AutoJump bool
+}
+
+type aabb struct {
+	minX, minY, minZ float64
+	maxX, maxY, maxZ float64
+}
+
+// Sets the input used by the physics simulation.
+func (client *Client) SetInput(input Input) {
+	client.playerMutex.Lock()
+	client.input = input
+	client.playerMutex.Unlock()
+}
+
+// Sets the direction the player is facing, in degrees, at once and cancelling any turn
+// started by LookAt.
+func (client *Client) SetLook(yaw float32, pitch float32) {
+	client.playerMutex.Lock()
+	client.PlayerYaw, client.PlayerPitch = yaw, pitch
+	client.looking = false
+	client.playerMutex.Unlock()
+}
+
+// Returns the position of the player's feet. Use this rather than reading PlayerX, PlayerY
+// and PlayerZ while the physics simulation is running.
+func (client *Client) Position() (x float64, y float64, z float64) {
+	client.playerMutex.Lock()
+	defer client.playerMutex.Unlock()
+
+	return client.PlayerX, client.PlayerY, client.PlayerZ
+}
+
+// Returns the player's health and food levels, out of 20, and food saturation.
+func (client *Client) Health() (health int16, food int16, saturation float32) {
+	client.playerMutex.Lock()
+	defer client.playerMutex.Unlock()
+
+	return client.PlayerHealth, client.PlayerFood, client.PlayerSaturation
+}
+
+// Reports whether the player is standing on a block.
+func (client *Client) OnGround() (onGround bool) {
+	client.playerMutex.Lock()
+	defer client.playerMutex.Unlock()
+
+	return client.PlayerOnGround
+}
+
+// Advances the physics simulation by one tick, moving the player according to the current
+// input and their velocity, and colliding with blocks in the stored world. Unloaded
+// blocks are treated as solid, and the player does not move at all while the column they
+// are in is unloaded, as in the vanilla client. PositionSender calls this every tick when
+// Physics is set.
+func (client *Client) PhysicsTick() {
+	client.playerMutex.Lock()
+	defer client.playerMutex.Unlock()
+
+	world := client.World.Snapshot()
+
+	if _, ok := world.GetColumn(BlockCoordAt(client.PlayerX, client.PlayerY, client.PlayerZ).Column()); !ok {
+		client.PlayerVelX, client.PlayerVelY, client.PlayerVelZ = 0, 0, 0
+		return
+	}
+
+	input := client.controlInput()
+	forward, strafe := input.Forward*0.98, input.Strafe*0.98
+
+	if input.Sneak {
+		forward *= sneakFactor
+		strafe *= sneakFactor
+	}
+
+	box := client.playerBox()
+	water := world.touches(box, resources.Water)
+	lava := world.touches(box, resources.Lava)
+
+	if water || lava {
+		drag := 0.8
+		if lava {
+			drag = 0.5
+		}
+
+		if input.Jump {
+			client.PlayerVelY += 0.04
+			client.jumping = false
+		}
+
+		client.accelerate(strafe, forward, airAcceleration)
+		client.move(world, client.PlayerVelX, client.PlayerVelY, client.PlayerVelZ)
+
+		client.PlayerVelX *= drag
+		client.PlayerVelY = client.PlayerVelY*drag - 0.02
+		client.PlayerVelZ *= drag
+
+		// Climb out onto a bank.
+		if client.collidedHorizontally && !world.collides(client.playerBox().offset(0, 0.6, 0)) {
+			client.PlayerVelY = 0.3
+		}
+
+	} else {
+		slipperiness, acceleration := airSlipperiness, airAcceleration
+		if client.PlayerOnGround {
+			slipperiness, acceleration = groundSlipperiness, groundAcceleration
+		}
+
+		if input.Sprint && forward > 0 && !input.Sneak {
+			acceleration *= sprintFactor
+		}
+
+		jump := input.Jump || (input.AutoJump && client.collidedHorizontally)
+
+		if jump && client.PlayerOnGround {
+			client.PlayerVelY = JumpVelocity
+			client.jumping = false
+
+			if input.Sprint {
+				yaw := float64(client.PlayerYaw) * math.Pi / 180
+				client.PlayerVelX -= math.Sin(yaw) * sprintJumpBoost
+				client.PlayerVelZ += math.Cos(yaw) * sprintJumpBoost
+			}
+		}
+
+		client.accelerate(strafe, forward, acceleration)
+
+		ladder := world.touches(box, resources.Climbable)
+
+		if ladder {
+			client.PlayerVelX = clamp(client.PlayerVelX, -ladderSpeed, ladderSpeed)
+			client.PlayerVelZ = clamp(client.PlayerVelZ, -ladderSpeed, ladderSpeed)
+			client.PlayerVelY = math.Max(client.PlayerVelY, -ladderSpeed)
+
+			if input.Sneak {
+				client.PlayerVelY = math.Max(client.PlayerVelY, 0)
+			}
+		}
+
+		client.move(world, client.PlayerVelX, client.PlayerVelY, client.PlayerVelZ)
+
+		if ladder && client.collidedHorizontally {
+			client.PlayerVelY = ladderClimbSpeed
+		}
+
+		client.PlayerVelY = (client.PlayerVelY - Gravity) * Drag
+		client.PlayerVelX *= slipperiness
+		client.PlayerVelZ *= slipperiness
+	}
+
+	client.PlayerStance = client.PlayerY + EyeHeight
+}
+
+// Adds to the player's horizontal velocity in the direction of the input.
+func (client *Client) accelerate(strafe float64, forward float64, acceleration float64) {
+	d := strafe*strafe + forward*forward
+	if d < 1.0e-4 {
+		return
+	}
+
+	d = math.Sqrt(d)
+	if d < 1 {
+		d = 1
+	}
+
+	strafe *= acceleration / d
+	forward *= acceleration / d
+
+	yaw := float64(client.PlayerYaw) * math.Pi / 180
+	sin, cos := math.Sin(yaw), math.Cos(yaw)
+
+	client.PlayerVelX += strafe*cos - forward*sin
+	client.PlayerVelZ += forward*cos + strafe*sin
+}
+
+// Moves the player by up to (dx, dy, dz), stopping at solid blocks, and updates whether
+// they are on the ground. Velocity along an axis is cancelled when movement along it is
+// blocked.
+func (client *Client) move(world *Snapshot, dx float64, dy float64, dz float64) {
+	start := client.playerBox()
+	box, mx, my, mz := world.clipMove(start, dx, dy, dz)
+
+	blockedY := my != dy
+	onGround := blockedY && dy < 0
+
+	// Try stepping up onto a ledge if walking into one while on the ground, and keep the
+	// result if it gets further.
+	if (client.PlayerOnGround || onGround) && (mx != dx || mz != dz) {
+		stepped, _, up, _ := world.clipMove(start, 0, StepHeight, 0)
+		stepped, sx, _, sz := world.clipMove(stepped, dx, 0, dz)
+		fall := -up + math.Min(dy, 0)
+		stepped, _, down, _ := world.clipMove(stepped, 0, fall, 0)
+
+		if sx*sx+sz*sz > mx*mx+mz*mz {
+			box, mx, mz = stepped, sx, sz
+			blockedY = down != fall
+			onGround = blockedY
+		}
+	}
+
+	client.PlayerX = (box.minX + box.maxX) / 2
+	client.PlayerY = box.minY
+	client.PlayerZ = (box.minZ + box.maxZ) / 2
+
+	client.collidedHorizontally = mx != dx || mz != dz
+	client.PlayerOnGround = onGround
+
+	if mx != dx {
+		client.PlayerVelX = 0
+	}
+
+	if blockedY {
+		client.PlayerVelY = 0
+	}
+
+	if mz != dz {
+		client.PlayerVelZ = 0
+	}
+}
+
+func (client *Client) playerBox() (box aabb) {
+	r := PlayerWidth / 2
+
+	return aabb{
+		client.PlayerX - r, client.PlayerY, client.PlayerZ - r,
+		client.PlayerX + r, client.PlayerY + PlayerHeight, client.PlayerZ + r,
+	}
+}
+
+// Moves a box by up to (dx, dy, dz) without entering a solid block, one axis at a time in
+// the order Y, X, Z. It returns the moved box and the distance moved along each axis.
+func (world *Snapshot) clipMove(box aabb, dx float64, dy float64, dz float64) (result aabb, mx float64, my float64, mz float64) {
+	obstacles := world.collisionBoxes(box.expand(dx, dy, dz))
+
+	for _, o := range obstacles {
+		dy = o.clipY(box, dy)
+	}
+
+	box = box.offset(0, dy, 0)
+
+	for _, o := range obstacles {
+		dx = o.clipX(box, dx)
+	}
+
+	box = box.offset(dx, 0, 0)
+
+	for _, o := range obstacles {
+		dz = o.clipZ(box, dz)
+	}
+
+	box = box.offset(0, 0, dz)
+
+	return box, dx, dy, dz
+}
+
+// Returns the boxes of the solid or unloaded blocks that overlap a box. Every solid block
+// is treated as a full cube.
+func (world *Snapshot) collisionBoxes(box aabb) (boxes []aabb) {
+	x0, x1 := floor(box.minX), floor(box.maxX)
+	y0, y1 := floor(box.minY), floor(box.maxY)
+	z0, z1 := floor(box.minZ), floor(box.maxZ)
+
+	for y := y0; y <= y1; y++ {
+		if y < 0 || y > 255 {
+			continue
+		}
+
+		for z := z0; z <= z1; z++ {
+			for x := x0; x <= x1; x++ {
+				block, ok := world.GetBlock(x, y, z)
+				if !ok || block.Is(resources.Solid) {
+					fx, fy, fz := float64(x), float64(y), float64(z)
+					boxes = append(boxes, aabb{fx, fy, fz, fx + 1, fy + 1, fz + 1})
+				}
+			}
+		}
+	}
+
+	return boxes
+}
+
+// Reports whether a box overlaps any solid or unloaded block.
+func (world *Snapshot) collides(box aabb) (collides bool) {
+	for _, o := range world.collisionBoxes(box) {
+		if o.intersects(box) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Reports whether a box overlaps any block in the given categories.
+func (world *Snapshot) touches(box aabb, categories resources.BlockCategory) (touches bool) {
+	const e = 0.001
+
+	for y := floor(box.minY + e); y <= floor(box.maxY-e); y++ {
+		for z := floor(box.minZ + e); z <= floor(box.maxZ-e); z++ {
+			for x := floor(box.minX + e); x <= floor(box.maxX-e); x++ {
+				block, _ := world.GetBlock(x, y, z)
+				if block.Is(categories) {
+					return true
+				}
+			}
+		}
+	}
+
+	return false
+}
+
+func (box aabb) offset(dx float64, dy float64, dz float64) (result aabb) {
+	return aabb{box.minX + dx, box.minY + dy, box.minZ + dz, box.maxX + dx, box.maxY + dy, box.maxZ + dz}
+}
+
+// Returns the box extended to cover its movement by (dx, dy, dz).
+func (box aabb) expand(dx float64, dy float64, dz float64) (result aabb) {
+	result = box
+
+	if dx < 0 {
+		result.minX += dx
+	} else {
+		result.maxX += dx
+	}
+
+	if dy < 0 {
+		result.minY += dy
+	} else {
+		result.maxY += dy
+	}
+
+	if dz < 0 {
+		result.minZ += dz
+	} else {
+		result.maxZ += dz
+	}
+
+	return result
+}
+
+func (box aabb) intersects(other aabb) (intersects bool) {
+	return box.maxX > other.minX && box.minX < other.maxX &&
+		box.maxY > other.minY && box.minY < other.maxY &&
+		box.maxZ > other.minZ && box.minZ < other.maxZ
+}
+
+// Returns how far mover can move along X, up to d, before hitting box.
+func (box aabb) clipX(mover aabb, d float64) (result float64) {
+	if mover.maxY <= box.minY || mover.minY >= box.maxY || mover.maxZ <= box.minZ || mover.minZ >= box.maxZ {
+		return d
+	}
+
+	return clipAxis(mover.minX, mover.maxX, box.minX, box.maxX, d)
+}
+
+func (box aabb) clipY(mover aabb, d float64) (result float64) {
+	if mover.maxX <= box.minX || mover.minX >= box.maxX || mover.maxZ <= box.minZ || mover.minZ >= box.maxZ {
+		return d
+	}
+
+	return clipAxis(mover.minY, mover.maxY, box.minY, box.maxY, d)
+}
+
+func (box aabb) clipZ(mover aabb, d float64) (result float64) {
+	if mover.maxX <= box.minX || mover.minX >= box.maxX || mover.maxY <= box.minY || mover.minY >= box.maxY {
+		return d
+	}
+
+	return clipAxis(mover.minZ, mover.maxZ, box.minZ, box.maxZ, d)
+}
+
+func clipAxis(moverMin float64, moverMax float64, min float64, max float64, d float64) (result float64) {
+	if d > 0 && moverMax <= min {
+		return math.Min(d, min-moverMax)
+	}
+
+	if d < 0 && moverMin >= max {
+		return math.Max(d, max-moverMin)
+	}
+
+	return d
+}
+
+func clamp(v float64, min float64, max float64) (result float64) {
+	return math.Max(min, math.Min(max, v))
+}
@@ -0,0 +1,159 @@
+package mcclient
+
+import (
+	"sort"
+	"strings"
+)
+
+// Another player within sight of the client.
+type PlayerEntity struct {
+	EntityID int32
+	Name     string
+	X        float64
+	Y        float64 // The Y coordinate of the player's feet.
+	Z        float64
+	Yaw      float32
+	Pitch    float32
+}
+
+// Returns the players within sight, sorted by name.
+func (client *Client) Players() (players []PlayerEntity) {
+	client.entityMutex.Lock()
+	defer client.entityMutex.Unlock()
+
+	for _, player := range client.players {
+		players = append(players, *player)
+	}
+
+	sort.Slice(players, func(i, j int) bool {
+		return players[i].Name < players[j].Name
+	})
+
+	return players
+}
+
+// Returns the player within sight with the given name, ignoring case.
+func (client *Client) PlayerByName(name string) (player PlayerEntity, ok bool) {
+	client.entityMutex.Lock()
+	defer client.entityMutex.Unlock()
+
+	for _, p := range client.players {
+		if strings.EqualFold(p.Name, name) {
+			return *p, true
+		}
+	}
+
+	return PlayerEntity{}, false
+}
+
+// A player in the player list, which shows everyone online.
+type ListedPlayer struct {
+	Name string
+	Ping int16 // In milliseconds.
+}
+
+// Returns the players online, as shown in the player list, sorted by name.
+func (client *Client) OnlinePlayers() (players []ListedPlayer) {
+	client.entityMutex.Lock()
+	defer client.entityMutex.Unlock()
+
+	for name, ping := range client.playerList {
+		players = append(players, ListedPlayer{name, ping})
+	}
+
+	sort.Slice(players, func(i, j int) bool {
+		return strings.ToLower(players[i].Name) < strings.ToLower(players[j].Name)
+	})
+
+	return players
+}
+
+// Adds a player to the player list, or removes them, as told by packet 0xC9.
+func (client *Client) listPlayer(name string, online bool, ping int16) {
+	client.entityMutex.Lock()
+	defer client.entityMutex.Unlock()
+
+	if !online {
+		delete(client.playerList, name)
+		return
+	}
+
+	if client.playerList == nil {
+		client.playerList = make(map[string]int16)
+	}
+
+	client.playerList[name] = ping
+}
+
+// Starts tracking a player spawned by packet 0x14. Positions are in 1/32 blocks and
+// angles in 1/256 turns, as in the packets.
+func (client *Client) spawnPlayer(entityID int32, name string, x int32, y int32, z int32, yaw int8, pitch int8) {
+	client.entityMutex.Lock()
+	defer client.entityMutex.Unlock()
+
+	if client.players == nil {
+		client.players = make(map[int32]*PlayerEntity)
+	}
+
+	client.players[entityID] = &PlayerEntity{
+		EntityID: entityID,
+		Name:     name,
+		X:        float64(x) / 32,
+		Y:        float64(y) / 32,
+		Z:        float64(z) / 32,
+		Yaw:      packetAngle(yaw),
+		Pitch:    packetAngle(pitch),
+	}
+}
+
+// Moves a tracked player by a relative offset in 1/32 blocks.
+func (client *Client) movePlayer(entityID int32, dx int8, dy int8, dz int8) {
+	client.entityMutex.Lock()
+	defer client.entityMutex.Unlock()
+
+	if player, ok := client.players[entityID]; ok {
+		player.X += float64(dx) / 32
+		player.Y += float64(dy) / 32
+		player.Z += float64(dz) / 32
+	}
+}
+
+// Moves a tracked player to an absolute position in 1/32 blocks.
+func (client *Client) teleportPlayer(entityID int32, x int32, y int32, z int32) {
+	client.entityMutex.Lock()
+	defer client.entityMutex.Unlock()
+
+	if player, ok := client.players[entityID]; ok {
+		player.X, player.Y, player.Z = float64(x)/32, float64(y)/32, float64(z)/32
+	}
+}
+
+// Turns a tracked player.
+func (client *Client) turnPlayer(entityID int32, yaw int8, pitch int8) {
+	client.entityMutex.Lock()
+	defer client.entityMutex.Unlock()
+
+	if player, ok := client.players[entityID]; ok {
+		player.Yaw, player.Pitch = packetAngle(yaw), packetAngle(pitch)
+	}
+}
+
+// Stops tracking entities that have been destroyed, or every entity if ids is nil.
+func (client *Client) forgetEntities(ids []int32) {
+	client.entityMutex.Lock()
+	defer client.entityMutex.Unlock()
+
+	if ids == nil {
+		client.players = nil
+		return
+	}
+
+	for _, id := range ids {
+		delete(client.players, id)
+	}
+}
+
+// Converts an angle in 1/256 turns to degrees.
+func packetAngle(angle int8) (degrees float32) {
+	return float32(angle) * 360 / 256
+}
@@ -0,0 +1,383 @@
+package mcclient
+
+import (
+	"github.com/kierdavis/mc/resources"
+	"sort"
+)
+
+type BlockCoord struct {
+	X int
+	Y int
+	Z int
+}
+
+// Returns the block containing a point.
+func BlockCoordAt(x float64, y float64, z float64) (coord BlockCoord) {
+	return BlockCoord{floor(x), floor(y), floor(z)}
+}
+
+// Returns the column containing a block.
+func (coord BlockCoord) Column() (column ColumnCoord) {
+	return ColumnCoord{coord.X >> 4, coord.Z >> 4}
+}
+
+// Returns the squared Euclidean distance between two blocks.
+func (coord BlockCoord) DistanceSq(other BlockCoord) (d int) {
+	dx, dy, dz := coord.X-other.X, coord.Y-other.Y, coord.Z-other.Z
+	return dx*dx + dy*dy + dz*dz
+}
+
+// A block found by a search.
+type FoundBlock struct {
+	BlockCoord
+	Block Block
+}
+
+// Decides whether a block is one being searched for. It is given the block's position so
+// that it can look at its surroundings.
+type BlockPredicate func(x int, y int, z int, block Block) bool
+
+// Returns a predicate matching blocks with any of the given IDs.
+func MatchIDs(ids ...uint16) (predicate BlockPredicate) {
+	return func(x int, y int, z int, block Block) bool {
+		for _, id := range ids {
+			if block.ID == id {
+				return true
+			}
+		}
+
+		return false
+	}
+}
+
+// Returns a predicate matching blocks in any of the given categories.
+func MatchCategories(categories resources.BlockCategory) (predicate BlockPredicate) {
+	return func(x int, y int, z int, block Block) bool {
+		return block.Is(categories)
+	}
+}
+
+// Calls fn for each column in the snapshot, in no particular order, until it returns
+// false.
+func (snapshot *Snapshot) ForEachColumn(fn func(coord ColumnCoord, column *Column) bool) {
+	for coord, column := range snapshot.columns {
+		if !fn(coord, column) {
+			return
+		}
+	}
+}
+
+// Returns every loaded block within a box (inclusive, corners in any order) that matches
+// the predicate. Unloaded parts of the box are skipped.
+func (snapshot *Snapshot) FindBlocks(corner1 BlockCoord, corner2 BlockCoord, match BlockPredicate) (found []FoundBlock) {
+	min, max := sortCorners(corner1, corner2)
+
+	for _, cc := range chunksInBox(min, max) {
+		found = snapshot.searchChunk(cc, min, max, match, found)
+	}
+
+	return found
+}
+
+// Returns every loaded block within radius blocks of centre that matches the predicate,
+// nearest first.
+func (snapshot *Snapshot) FindBlocksNear(centre BlockCoord, radius int, match BlockPredicate) (found []FoundBlock) {
+	radiusSq := radius * radius
+
+	within := func(x int, y int, z int, block Block) bool {
+		return centre.DistanceSq(BlockCoord{x, y, z}) <= radiusSq && match(x, y, z, block)
+	}
+
+	found = snapshot.FindBlocks(centre.offset(-radius), centre.offset(radius), within)
+
+	sort.SliceStable(found, func(i, j int) bool {
+		return centre.DistanceSq(found[i].BlockCoord) < centre.DistanceSq(found[j].BlockCoord)
+	})
+
+	return found
+}
+
+// Returns the loaded block matching the predicate that is nearest to centre in a straight
+// line, searching no further than radius blocks. Chunks are searched nearest first, and
+// the search stops once no closer match is possible.
+func (snapshot *Snapshot) NearestBlock(centre BlockCoord, radius int, match BlockPredicate) (nearest FoundBlock, ok bool) {
+	min, max := centre.offset(-radius), centre.offset(radius)
+	chunks := chunksInBox(min, max)
+
+	sort.SliceStable(chunks, func(i, j int) bool {
+		return chunks[i].distanceSq(centre) < chunks[j].distanceSq(centre)
+	})
+
+	bestSq := radius*radius + 1
+
+	for _, cc := range chunks {
+		if cc.distanceSq(centre) >= bestSq {
+			break
+		}
+
+		for _, f := range snapshot.searchChunk(cc, min, max, match, nil) {
+			d := centre.DistanceSq(f.BlockCoord)
+			if d < bestSq {
+				nearest, bestSq, ok = f, d, true
+			}
+		}
+	}
+
+	return nearest, ok
+}
+
+// Returns the loaded block matching the predicate that can be reached from start in the
+// fewest steps, and the number of steps. Steps are taken in the six axis directions
+// through loaded blocks that are not solid, and the matching block need only be next to
+// the last one, so solid blocks such as logs can be found. Gravity is not taken into
+// account. The search gives up after maxSteps steps.
+func (snapshot *Snapshot) NearestBlockByPath(start BlockCoord, maxSteps int, match BlockPredicate) (nearest FoundBlock, steps int, ok bool) {
+	block, ok := snapshot.GetBlock(start.X, start.Y, start.Z)
+	if !ok {
+		return FoundBlock{}, 0, false
+	}
+
+	if match(start.X, start.Y, start.Z, block) {
+		return FoundBlock{start, block}, 0, true
+	}
+
+	visited := map[BlockCoord]bool{start: true}
+	queue := []BlockCoord{start}
+
+	for steps = 1; steps <= maxSteps && len(queue) > 0; steps++ {
+		var next []BlockCoord
+
+		for _, coord := range queue {
+			for _, n := range coord.neighbours() {
+				if visited[n] {
+					continue
+				}
+
+				visited[n] = true
+
+				block, ok := snapshot.GetBlock(n.X, n.Y, n.Z)
+				if !ok {
+					continue
+				}
+
+				if match(n.X, n.Y, n.Z, block) {
+					return FoundBlock{n, block}, steps, true
+				}
+
+				if !block.Is(resources.Solid) {
+					next = append(next, n)
+				}
+			}
+		}
+
+		queue = next
+	}
+
+	return FoundBlock{}, 0, false
+}
+
+// Returns the number of blocks of each ID in the chunk, or false if it is not loaded.
+func (snapshot *Snapshot) CountBlocks(cx int, cy int, cz int) (counts map[uint16]int, ok bool) {
+	chunk, ok := snapshot.GetChunk(cx, cy, cz)
+	if !ok {
+		return nil, false
+	}
+
+	return chunk.CountBlocks(), true
+}
+
+// Returns the number of blocks of each ID in the chunk.
+func (chunk *Chunk) CountBlocks() (counts map[uint16]int) {
+	var byID [4096]int
+
+	for i := 0; i < 4096; i++ {
+		id := uint16(getNibble(chunk.AddTypes, i)) << 8
+		if chunk.BlockTypes != nil {
+			id |= uint16(chunk.BlockTypes[i])
+		}
+
+		byID[id]++
+	}
+
+	counts = make(map[uint16]int)
+
+	for id, n := range byID {
+		if n > 0 {
+			counts[uint16(id)] = n
+		}
+	}
+
+	return counts
+}
+
+// The following take a snapshot of the world for each call; use a Snapshot directly to
+// run several queries against the same state.
+
+func (client *Client) ForEachColumn(fn func(coord ColumnCoord, column *Column) bool) {
+	client.World.Snapshot().ForEachColumn(fn)
+}
+
+func (client *Client) FindBlocks(corner1 BlockCoord, corner2 BlockCoord, match BlockPredicate) (found []FoundBlock) {
+	return client.World.Snapshot().FindBlocks(corner1, corner2, match)
+}
+
+func (client *Client) FindBlocksNear(centre BlockCoord, radius int, match BlockPredicate) (found []FoundBlock) {
+	return client.World.Snapshot().FindBlocksNear(centre, radius, match)
+}
+
+func (client *Client) NearestBlock(centre BlockCoord, radius int, match BlockPredicate) (nearest FoundBlock, ok bool) {
+	return client.World.Snapshot().NearestBlock(centre, radius, match)
+}
+
+func (client *Client) NearestBlockByPath(start BlockCoord, maxSteps int, match BlockPredicate) (nearest FoundBlock, steps int, ok bool) {
+	return client.World.Snapshot().NearestBlockByPath(start, maxSteps, match)
+}
+
+func (client *Client) CountBlocks(cx int, cy int, cz int) (counts map[uint16]int, ok bool) {
+	return client.World.Snapshot().CountBlocks(cx, cy, cz)
+}
+
+type chunkCoord struct {
+	X int
+	Y int
+	Z int
+}
+
+// Returns the squared distance from a block to the nearest block in the chunk.
+func (cc chunkCoord) distanceSq(coord BlockCoord) (d int) {
+	dx := axisDistance(coord.X, cc.X*16, cc.X*16+15)
+	dy := axisDistance(coord.Y, cc.Y*16, cc.Y*16+15)
+	dz := axisDistance(coord.Z, cc.Z*16, cc.Z*16+15)
+	return dx*dx + dy*dy + dz*dz
+}
+
+// Appends the blocks in one chunk that lie within the box and match the predicate. The
+// chunk's arrays are read directly rather than through GetBlock. A missing chunk in a
+// loaded column is scanned as all air, lit as Column.GetBlock would light it, as the
+// predicate may depend on the position, biome or light.
+func (snapshot *Snapshot) searchChunk(cc chunkCoord, min BlockCoord, max BlockCoord, match BlockPredicate, found []FoundBlock) (result []FoundBlock) {
+	column, ok := snapshot.columns[ColumnCoord{cc.X, cc.Z}]
+	if !ok {
+		return found
+	}
+
+	x0, x1 := clampToChunk(min.X, max.X, cc.X)
+	y0, y1 := clampToChunk(min.Y, max.Y, cc.Y)
+	z0, z1 := clampToChunk(min.Z, max.Z, cc.Z)
+
+	chunk, ok := column.Chunks[cc.Y]
+	if !ok {
+		chunk = &Chunk{SkyLight: column.missingSkyLight(cc.Y)}
+	}
+
+	for y := y0; y <= y1; y++ {
+		for z := z0; z <= z1; z++ {
+			for x := x0; x <= x1; x++ {
+				block := chunk.GetBlock(x, y, z)
+				block.Biome = UnknownBiome
+
+				if column.Biomes != nil {
+					block.Biome = column.Biomes[z<<4|x]
+				}
+
+				wx, wy, wz := cc.X*16+x, cc.Y*16+y, cc.Z*16+z
+
+				if match(wx, wy, wz, block) {
+					found = append(found, FoundBlock{BlockCoord{wx, wy, wz}, block})
+				}
+			}
+		}
+	}
+
+	return found
+}
+
+// Returns the chunks that overlap a box, limited to the height of the world.
+func chunksInBox(min BlockCoord, max BlockCoord) (chunks []chunkCoord) {
+	if min.Y < 0 {
+		min.Y = 0
+	}
+
+	if max.Y > 255 {
+		max.Y = 255
+	}
+
+	for cy := min.Y >> 4; cy <= max.Y>>4; cy++ {
+		for cz := min.Z >> 4; cz <= max.Z>>4; cz++ {
+			for cx := min.X >> 4; cx <= max.X>>4; cx++ {
+				chunks = append(chunks, chunkCoord{cx, cy, cz})
+			}
+		}
+	}
+
+	return chunks
+}
+
+// Returns the part of the range [min, max] that lies in chunk c, relative to the chunk.
+func clampToChunk(min int, max int, c int) (lo int, hi int) {
+	lo, hi = min-c*16, max-c*16
+
+	if lo < 0 {
+		lo = 0
+	}
+
+	if hi > 15 {
+		hi = 15
+	}
+
+	return lo, hi
+}
+
+func axisDistance(v int, lo int, hi int) (d int) {
+	if v < lo {
+		return lo - v
+	}
+
+	if v > hi {
+		return v - hi
+	}
+
+	return 0
+}
+
+func sortCorners(a BlockCoord, b BlockCoord) (min BlockCoord, max BlockCoord) {
+	min, max = a, b
+
+	if min.X > max.X {
+		min.X, max.X = max.X, min.X
+	}
+
+	if min.Y > max.Y {
+		min.Y, max.Y = max.Y, min.Y
+	}
+
+	if min.Z > max.Z {
+		min.Z, max.Z = max.Z, min.Z
+	}
+
+	return min, max
+}
+
+func (coord BlockCoord) offset(d int) (result BlockCoord) {
+	return BlockCoord{coord.X + d, coord.Y + d, coord.Z + d}
+}
+
+func (coord BlockCoord) neighbours() (result [6]BlockCoord) {
+	return [6]BlockCoord{
+		{coord.X, coord.Y - 1, coord.Z},
+		{coord.X, coord.Y + 1, coord.Z},
+		{coord.X, coord.Y, coord.Z - 1},
+		{coord.X, coord.Y, coord.Z + 1},
+		{coord.X - 1, coord.Y, coord.Z},
+		{coord.X + 1, coord.Y, coord.Z},
+	}
+}
+
+func floor(v float64) (i int) {
+	i = int(v)
+	if float64(i) > v {
+		i--
+	}
+
+	return i
+}
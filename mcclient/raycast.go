@@ -0,0 +1,216 @@
+package mcclient
+
+import (
+	"github.com/kierdavis/mc/resources"
+	"math"
+)
+
+// The face of a block, numbered as in the dig and block placement packets.
+type Face int8
+
+const (
+	FaceBottom Face = iota // -Y
+	FaceTop                // +Y
+	FaceNorth              // -Z
+	FaceSouth              // +Z
+	FaceWest               // -X
+	FaceEast               // +X
+)
+
+// The height of the player's eyes above their feet.
+const EyeHeight = 1.62
+
+// How far away a survival player may dig or place blocks.
+const Reach = 4.5
+
+// The result of a ray cast.
+type RayHit struct {
+	BlockCoord
+	Block    Block
+	Face     Face    // The face the ray entered the block through.
+	HitX     float64 // The point where the ray met the block.
+	HitY     float64
+	HitZ     float64
+	Distance float64 // The distance from the start of the ray to the hit point.
+}
+
+// Returns the unit vector pointing in the direction given by a yaw and pitch, in degrees
+// as used by the protocol. A yaw of 0 faces +Z and 90 faces -X; a pitch of 90 faces down.
+func LookDirection(yaw float32, pitch float32) (dx float64, dy float64, dz float64) {
+	y := float64(yaw) * math.Pi / 180
+	p := float64(pitch) * math.Pi / 180
+
+	return -math.Sin(y) * math.Cos(p), -math.Sin(p), math.Cos(y) * math.Cos(p)
+}
+
+// Returns the yaw and pitch needed to look from one point towards another.
+func LookAngles(fromX float64, fromY float64, fromZ float64, toX float64, toY float64, toZ float64) (yaw float32, pitch float32) {
+	dx, dy, dz := toX-fromX, toY-fromY, toZ-fromZ
+
+	yaw = float32(math.Atan2(-dx, dz) * 180 / math.Pi)
+	pitch = float32(-math.Atan2(dy, math.Hypot(dx, dz)) * 180 / math.Pi)
+
+	return yaw, pitch
+}
+
+// Returns the position of the player's eyes. PlayerStance is used when it holds a
+// plausible eye height, as it does after the server has positioned the player.
+func (client *Client) EyePosition() (x float64, y float64, z float64) {
+	client.playerMutex.Lock()
+	defer client.playerMutex.Unlock()
+
+	eyeY := client.PlayerStance
+	if eyeY <= client.PlayerY || eyeY > client.PlayerY+2 {
+		eyeY = client.PlayerY + EyeHeight
+	}
+
+	return client.PlayerX, eyeY, client.PlayerZ
+}
+
+// Returns the yaw and pitch needed for the player to look at a point, such as an
+// entity's position.
+func (client *Client) LookAnglesTo(x float64, y float64, z float64) (yaw float32, pitch float32) {
+	eyeX, eyeY, eyeZ := client.EyePosition()
+	return LookAngles(eyeX, eyeY, eyeZ, x, y, z)
+}
+
+// Returns the yaw and pitch needed for the player to look at the centre of a block.
+func (client *Client) LookAnglesToBlock(coord BlockCoord) (yaw float32, pitch float32) {
+	return client.LookAnglesTo(float64(coord.X)+0.5, float64(coord.Y)+0.5, float64(coord.Z)+0.5)
+}
+
+// Casts a ray from the player's eyes in the direction they are looking, returning the
+// first targetable block within maxDistance.
+func (client *Client) RayCast(maxDistance float64) (hit RayHit, ok bool) {
+	x, y, z := client.EyePosition()
+
+	client.playerMutex.Lock()
+	dx, dy, dz := LookDirection(client.PlayerYaw, client.PlayerPitch)
+	client.playerMutex.Unlock()
+
+	return client.World.Snapshot().RayCast(x, y, z, dx, dy, dz, maxDistance, nil)
+}
+
+// Casts a ray from the player's eyes towards the centre of a block. It returns the hit if
+// the first targetable block on the way is that block and it is within reach, giving the
+// face to use when digging it or placing against it.
+func (client *Client) TargetBlock(coord BlockCoord) (hit RayHit, ok bool) {
+	x, y, z := client.EyePosition()
+	dx := float64(coord.X) + 0.5 - x
+	dy := float64(coord.Y) + 0.5 - y
+	dz := float64(coord.Z) + 0.5 - z
+
+	hit, ok = client.World.Snapshot().RayCast(x, y, z, dx, dy, dz, Reach, nil)
+	if !ok || hit.BlockCoord != coord {
+		return RayHit{}, false
+	}
+
+	return hit, true
+}
+
+// Reports whether the centre of a block can be seen from the player's eyes, at any
+// distance.
+func (client *Client) CanSeeBlock(coord BlockCoord) (visible bool) {
+	x, y, z := client.EyePosition()
+	dx := float64(coord.X) + 0.5 - x
+	dy := float64(coord.Y) + 0.5 - y
+	dz := float64(coord.Z) + 0.5 - z
+	distance := math.Sqrt(dx*dx + dy*dy + dz*dz)
+
+	hit, ok := client.World.Snapshot().RayCast(x, y, z, dx, dy, dz, distance+1, nil)
+	return ok && hit.BlockCoord == coord
+}
+
+// Returns true for blocks that stop a ray cast by default: anything other than air and
+// liquids.
+func isTargetable(x int, y int, z int, block Block) (targetable bool) {
+	return !block.IsAir() && !block.Is(resources.Liquid)
+}
+
+// Follows a ray from (x, y, z) in the direction (dx, dy, dz), visiting every block it
+// passes through in order, and returns the first one matching the predicate within
+// maxDistance. A nil predicate matches any block but air and liquids. Every block is
+// treated as a full cube, and the block containing the start of the ray is skipped. The
+// cast fails if it reaches a block that is not loaded.
+func (snapshot *Snapshot) RayCast(x float64, y float64, z float64, dx float64, dy float64, dz float64, maxDistance float64, match BlockPredicate) (hit RayHit, ok bool) {
+	if match == nil {
+		match = isTargetable
+	}
+
+	length := math.Sqrt(dx*dx + dy*dy + dz*dz)
+	if length == 0 {
+		return RayHit{}, false
+	}
+
+	dx, dy, dz = dx/length, dy/length, dz/length
+
+	// Amanatides and Woo's traversal: t is the distance along the ray, and tMax holds the
+	// distance at which the ray next crosses a block boundary on each axis.
+	coord := BlockCoordAt(x, y, z)
+
+	stepX, tMaxX, tDeltaX := traversalAxis(x, dx)
+	stepY, tMaxY, tDeltaY := traversalAxis(y, dy)
+	stepZ, tMaxZ, tDeltaZ := traversalAxis(z, dz)
+
+	for {
+		var t float64
+		var face Face
+
+		if tMaxX < tMaxY && tMaxX < tMaxZ {
+			t = tMaxX
+			coord.X += stepX
+			tMaxX += tDeltaX
+			face = FaceEast
+			if stepX > 0 {
+				face = FaceWest
+			}
+
+		} else if tMaxY < tMaxZ {
+			t = tMaxY
+			coord.Y += stepY
+			tMaxY += tDeltaY
+			face = FaceTop
+			if stepY > 0 {
+				face = FaceBottom
+			}
+
+		} else {
+			t = tMaxZ
+			coord.Z += stepZ
+			tMaxZ += tDeltaZ
+			face = FaceSouth
+			if stepZ > 0 {
+				face = FaceNorth
+			}
+		}
+
+		if t > maxDistance {
+			return RayHit{}, false
+		}
+
+		block, ok := snapshot.GetBlock(coord.X, coord.Y, coord.Z)
+		if !ok {
+			return RayHit{}, false
+		}
+
+		if match(coord.X, coord.Y, coord.Z, block) {
+			return RayHit{coord, block, face, x + dx*t, y + dy*t, z + dz*t, t}, true
+		}
+	}
+}
+
+// Returns the step direction, the distance to the first boundary crossing and the
+// distance between crossings along one axis of a ray.
+func traversalAxis(origin float64, d float64) (step int, tMax float64, tDelta float64) {
+	if d == 0 {
+		return 0, math.Inf(1), math.Inf(1)
+	}
+
+	cell := math.Floor(origin)
+
+	if d > 0 {
+		return 1, (cell + 1 - origin) / d, 1 / d
+	}
+
+	return -1, (origin - cell) / -d, 1 / -d
+}
@@ -51,8 +51,6 @@ func (client *Client) dispatchPacket(id byte) (err error) {
 		}()
 	*/
 
-	println(id)
-
 	switch id {
 	case 0x00:
 		return client.handleKeepAlivePacket()
@@ -160,6 +158,8 @@ func (client *Client) dispatchPacket(id byte) (err error) {
 		return client.handlePlayerListItemPacket()
 	case 0xCA:
 		return client.handlePlayerAbilitiesPacket()
+	case 0xCB:
+		return client.handleTabCompletePacket()
 	case 0xFA:
 		return client.handlePluginMessagePacket()
 	case 0xFF:
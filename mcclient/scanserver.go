@@ -1,13 +1,20 @@
 package mcclient
 
 import (
+	"context"
+	"encoding/binary"
 	"fmt"
+	"io"
 	"net"
 	"strconv"
 	"strings"
-	"unicode/utf8"
+	"time"
+	"unicode/utf16"
 )
 
+// How long ScanServer waits for a server to answer.
+const ScanTimeout = 10 * time.Second
+
 type ScanServerResult struct {
 	ProtocolVersion  int
 	MinecraftVersion string
@@ -16,49 +23,73 @@ type ScanServerResult struct {
 	PlayersMax       int
 }
 
+// Pings a server as the server list does, giving up after ScanTimeout.
 func ScanServer(addr string) (result *ScanServerResult, err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), ScanTimeout)
+	defer cancel()
+
+	return ScanServerContext(ctx, addr)
+}
+
+// Pings a server as the server list does, giving up when ctx is done.
+func ScanServerContext(ctx context.Context, addr string) (result *ScanServerResult, err error) {
 	if strings.Index(addr, ":") < 0 {
 		addr += ":25565"
 	}
 
-	conn, err := net.Dial("tcp", addr)
+	var dialer net.Dialer
+
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
 	if err != nil {
 		return nil, err
 	}
 	defer conn.Close()
 
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	// Interrupt the write or read if ctx is cancelled before its deadline.
+	done := make(chan struct{})
+	defer close(done)
+
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.SetDeadline(time.Now())
+		case <-done:
+		}
+	}()
+
 	_, err = conn.Write([]byte{0xFE})
 	if err != nil {
-		return nil, err
+		return nil, scanError(ctx, err)
 	}
 
-	data := make([]byte, 1024)
-	n, err := conn.Read(data)
+	// The reply is a kick packet: 0xFF, then a string as a 16-bit length in characters
+	// followed by UTF-16 characters.
+	header := make([]byte, 3)
+	_, err = io.ReadFull(conn, header)
 	if err != nil {
-		return nil, err
+		return nil, scanError(ctx, err)
 	}
 
-	if data[0] != 0xFF {
+	if header[0] != 0xFF {
 		return nil, fmt.Errorf("Expected kick packet (0xFF)")
 	}
 
-	realLen := 0
-	runes := make([]rune, 0, (n-3)/2)
-
-	for i := 3; i < n; i += 2 {
-		r := (rune(data[i]) << 8) | rune(data[i+1])
-		runes = append(runes, r)
-		realLen += utf8.RuneLen(r)
+	data := make([]byte, 2*int(binary.BigEndian.Uint16(header[1:])))
+	_, err = io.ReadFull(conn, data)
+	if err != nil {
+		return nil, scanError(ctx, err)
 	}
 
-	b := make([]byte, realLen)
-	pos := 0
-
-	for _, r := range runes {
-		pos += utf8.EncodeRune(b[pos:], r)
+	units := make([]uint16, len(data)/2)
+	for i := range units {
+		units[i] = binary.BigEndian.Uint16(data[2*i:])
 	}
 
-	s := string(b)
+	s := string(utf16.Decode(units))
 
 	/*
 		if strings.HasPrefix(s, "\xc2\xa7") {
@@ -127,3 +158,12 @@ func ScanServer(addr string) (result *ScanServerResult, err error) {
 
 	return result, nil
 }
+
+// Returns the context's error in place of the timeout error caused by it being done.
+func scanError(ctx context.Context, err error) (result error) {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	return err
+}
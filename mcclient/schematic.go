@@ -0,0 +1,316 @@
+package mcclient
+
+import (
+	"compress/gzip"
+	"fmt"
+	"github.com/kierdavis/mc/nbt"
+	"io"
+	"sort"
+)
+
+// A cuboid of blocks, as stored in MCEdit .schematic files. Blocks are indexed by
+// (y*Length + z)*Width + x, relative to the minimum corner.
+type Schematic struct {
+	Width  int // Size along the X axis.
+	Height int // Size along the Y axis.
+	Length int // Size along the Z axis.
+
+	Blocks []uint16 // Block IDs, including the 4 extra bits of "add" types.
+	Data   []byte   // Block metadata.
+
+	// Entities and tile entities, in the same format as in Anvil chunks but with positions
+	// relative to the minimum corner. They are carried through reading and writing
+	// unchanged; the client does not track them, so exports from the world leave them empty.
+	Entities     []nbt.Compound
+	TileEntities []nbt.Compound
+}
+
+// The largest size of a schematic along any axis, as sizes are saved as 16-bit numbers.
+const MaxSchematicSize = 32767
+
+// The most blocks ExportSchematic will copy; about 50MB of memory.
+const MaxSchematicVolume = 1 << 24
+
+// A block to be placed at an absolute position.
+type BlockPlacement struct {
+	X, Y, Z int
+	ID      uint16
+	Data    byte
+}
+
+func NewSchematic(width int, height int, length int) (s *Schematic) {
+	volume := width * height * length
+
+	return &Schematic{
+		Width:  width,
+		Height: height,
+		Length: length,
+		Blocks: make([]uint16, volume),
+		Data:   make([]byte, volume),
+	}
+}
+
+func (s *Schematic) index(x int, y int, z int) (i int) {
+	return (y*s.Length+z)*s.Width + x
+}
+
+// Returns the block at a position relative to the minimum corner.
+func (s *Schematic) Block(x int, y int, z int) (id uint16, data byte) {
+	i := s.index(x, y, z)
+	return s.Blocks[i], s.Data[i]
+}
+
+func (s *Schematic) SetBlock(x int, y int, z int, id uint16, data byte) {
+	i := s.index(x, y, z)
+	s.Blocks[i] = id
+	s.Data[i] = data
+}
+
+// Returns the non-air blocks of the schematic positioned with its minimum corner at
+// (ox, oy, oz), ordered from the bottom layer upwards so that each block can be placed
+// against the ones below it.
+func (s *Schematic) Placements(ox int, oy int, oz int) (placements []BlockPlacement) {
+	for y := 0; y < s.Height; y++ {
+		for z := 0; z < s.Length; z++ {
+			for x := 0; x < s.Width; x++ {
+				id, data := s.Block(x, y, z)
+				if id != 0 {
+					placements = append(placements, BlockPlacement{ox + x, oy + y, oz + z, id, data})
+				}
+			}
+		}
+	}
+
+	sort.SliceStable(placements, func(i, j int) bool {
+		return placements[i].Y < placements[j].Y
+	})
+
+	return placements
+}
+
+// Copies the cuboid between two corners (inclusive, in any order) out of the stored
+// world, limited to the height of the world. It is an error for any of the blocks to be in
+// a chunk that has not been received, or for the cuboid to be bigger than
+// MaxSchematicSize along any axis or MaxSchematicVolume in all.
+func (client *Client) ExportSchematic(x1 int, y1 int, z1 int, x2 int, y2 int, z2 int) (s *Schematic, err error) {
+	if x1 > x2 {
+		x1, x2 = x2, x1
+	}
+
+	if y1 > y2 {
+		y1, y2 = y2, y1
+	}
+
+	if z1 > z2 {
+		z1, z2 = z2, z1
+	}
+
+	if y1 < 0 {
+		y1 = 0
+	}
+
+	if y2 > 255 {
+		y2 = 255
+	}
+
+	if y1 > y2 {
+		return nil, fmt.Errorf("Cuboid is outside the height of the world")
+	}
+
+	// The differences are taken as unsigned so that corners far apart cannot overflow.
+	if uint(x2-x1) >= MaxSchematicSize || uint(z2-z1) >= MaxSchematicSize {
+		return nil, fmt.Errorf("Cuboid is more than %d blocks across", MaxSchematicSize)
+	}
+
+	width, height, length := x2-x1+1, y2-y1+1, z2-z1+1
+	if int64(width)*int64(height)*int64(length) > MaxSchematicVolume {
+		return nil, fmt.Errorf("Cuboid of %dx%dx%d is more than %d blocks", width, height, length, MaxSchematicVolume)
+	}
+
+	s = NewSchematic(width, height, length)
+	snapshot := client.World.Snapshot()
+
+	for y := y1; y <= y2; y++ {
+		for z := z1; z <= z2; z++ {
+			for x := x1; x <= x2; x++ {
+				block, ok := snapshot.GetBlock(x, y, z)
+				if !ok {
+					return nil, fmt.Errorf("Block (%d, %d, %d) has not been loaded", x, y, z)
+				}
+
+				s.SetBlock(x-x1, y-y1, z-z1, block.ID, block.Metadata)
+			}
+		}
+	}
+
+	return s, nil
+}
+
+// Writes the schematic as a gzipped NBT file.
+func (s *Schematic) Write(w io.Writer) (err error) {
+	zw := gzip.NewWriter(w)
+
+	root, err := s.ToNBT()
+	if err != nil {
+		return err
+	}
+
+	err = nbt.Write(zw, "Schematic", root)
+	if err != nil {
+		return err
+	}
+
+	return zw.Close()
+}
+
+// Reads a gzipped .schematic file.
+func ReadSchematic(r io.Reader) (s *Schematic, err error) {
+	zr, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+
+	defer zr.Close()
+
+	_, root, err := nbt.Read(zr)
+	if err != nil {
+		return nil, err
+	}
+
+	return SchematicFromNBT(root)
+}
+
+func (s *Schematic) ToNBT() (root nbt.Compound, err error) {
+	if s.Width > MaxSchematicSize || s.Height > MaxSchematicSize || s.Length > MaxSchematicSize {
+		return nil, fmt.Errorf("Schematic is too big to save: %dx%dx%d", s.Width, s.Height, s.Length)
+	}
+
+	blocks := make([]byte, len(s.Blocks))
+	hasAdd := false
+
+	for i, id := range s.Blocks {
+		blocks[i] = byte(id)
+		if id > 0xFF {
+			hasAdd = true
+		}
+	}
+
+	root = nbt.Compound{
+		"Width":        int16(s.Width),
+		"Height":       int16(s.Height),
+		"Length":       int16(s.Length),
+		"Materials":    "Alpha",
+		"Blocks":       blocks,
+		"Data":         s.Data,
+		"Entities":     compoundList(s.Entities),
+		"TileEntities": compoundList(s.TileEntities),
+	}
+
+	// Unlike the Add arrays of Anvil sections, AddBlocks puts the even-indexed block in
+	// the high nibble.
+	if hasAdd {
+		add := make([]byte, (len(s.Blocks)+1)/2)
+
+		for i, id := range s.Blocks {
+			nibble := byte(id>>8) & 0x0F
+
+			if i%2 == 0 {
+				add[i/2] |= nibble << 4
+			} else {
+				add[i/2] |= nibble
+			}
+		}
+
+		root["AddBlocks"] = add
+	}
+
+	return root, nil
+}
+
+func SchematicFromNBT(root nbt.Compound) (s *Schematic, err error) {
+	width, ok1 := root.Short("Width")
+	height, ok2 := root.Short("Height")
+	length, ok3 := root.Short("Length")
+	if !ok1 || !ok2 || !ok3 || width < 0 || height < 0 || length < 0 {
+		return nil, fmt.Errorf("Schematic has a missing or bad size")
+	}
+
+	materials, ok := root.String("Materials")
+	if ok && materials != "Alpha" {
+		return nil, fmt.Errorf("Unsupported schematic materials %q", materials)
+	}
+
+	// Check the arrays before allocating anything, as the size could be huge.
+	volume := int64(width) * int64(height) * int64(length)
+
+	blocks, ok := root.ByteArray("Blocks")
+	if !ok || int64(len(blocks)) != volume {
+		return nil, fmt.Errorf("Schematic has missing or bad Blocks")
+	}
+
+	data, ok := root.ByteArray("Data")
+	if !ok || int64(len(data)) != volume {
+		return nil, fmt.Errorf("Schematic has missing or bad Data")
+	}
+
+	s = NewSchematic(int(width), int(height), int(length))
+
+	for i, b := range blocks {
+		s.Blocks[i] = uint16(b)
+	}
+
+	copy(s.Data, data)
+
+	// AddBlocks holds packed nibbles; some older tools instead wrote Add with a whole byte
+	// per block.
+	if add, ok := root.ByteArray("AddBlocks"); ok {
+		if len(add) != (len(blocks)+1)/2 {
+			return nil, fmt.Errorf("Schematic has a bad AddBlocks")
+		}
+
+		for i := range s.Blocks {
+			nibble := add[i/2] & 0x0F
+			if i%2 == 0 {
+				nibble = add[i/2] >> 4
+			}
+
+			s.Blocks[i] |= uint16(nibble) << 8
+		}
+
+	} else if add, ok := root.ByteArray("Add"); ok {
+		if len(add) != len(blocks) {
+			return nil, fmt.Errorf("Schematic has a bad Add")
+		}
+
+		for i := range s.Blocks {
+			s.Blocks[i] |= uint16(add[i]&0x0F) << 8
+		}
+	}
+
+	s.Entities = compoundsOf(root, "Entities")
+	s.TileEntities = compoundsOf(root, "TileEntities")
+
+	return s, nil
+}
+
+func compoundList(compounds []nbt.Compound) (list nbt.List) {
+	list.ElemType = nbt.TagCompound
+
+	for _, c := range compounds {
+		list.Elems = append(list.Elems, c)
+	}
+
+	return list
+}
+
+func compoundsOf(root nbt.Compound, name string) (compounds []nbt.Compound) {
+	list, _ := root.List(name)
+
+	for _, elem := range list.Elems {
+		if c, ok := elem.(nbt.Compound); ok {
+			compounds = append(compounds, c)
+		}
+	}
+
+	return compounds
+}
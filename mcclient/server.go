@@ -67,8 +67,6 @@ func (s *encryptedStream) Read(plain []byte) (n int, err error) {
 		return 0, err
 	}
 
-	fmt.Println("r encrypted ", encrypted)
-
 	blockSize := s.cipher.BlockSize()
 
 	for start := 0; start < n; start += blockSize {
@@ -86,14 +84,10 @@ func (s *encryptedStream) Read(plain []byte) (n int, err error) {
 		copy(plain[start:], plainBlock[:blockLength])
 	}
 
-	fmt.Println("r plain ", plain)
-
 	return n, nil
 }
 
 func (s *encryptedStream) Write(plain []byte) (n int, err error) {
-	fmt.Println("w plain ", plain)
-
 	encrypted := make([]byte, len(plain))
 	blockSize := s.cipher.BlockSize()
 	n = len(plain)
@@ -113,8 +107,6 @@ func (s *encryptedStream) Write(plain []byte) (n int, err error) {
 		copy(encrypted[start:], encryptedBlock[:blockLength])
 	}
 
-	fmt.Println("w encrypted ", encrypted)
-
 	n, err = s.conn.Write(encrypted)
 	if err != nil {
 		return 0, err
@@ -148,7 +140,10 @@ func (client *Client) connect() (err error) {
 		return err
 	}
 
-	client.conn = LogReadWriter{client.netConn}
+	client.conn = client.netConn
+	if client.DebugWriter != nil {
+		client.conn = LogReadWriter{client.netConn, client}
+	}
 
 	return nil
 }
@@ -426,18 +421,21 @@ func (client *Client) Join(addr string) (err error) {
 	client.PacketLogging = false
 
 	if client.DebugWriter != nil {
-		fmt.Fprintf(client.DebugWriter, "Joined!\n\nStarting position sender...\n\n")
+		fmt.Fprintf(client.DebugWriter, "Joined!\n\nStarting position and chat senders...\n\n")
 	}
 
 	// The receiver is run in the foreground with Run() now.
 
-	// Start the position sender background process.
+	// Start the position and chat sender background processes.
 	go client.PositionSender()
+	go client.ChatSender()
 
 	return nil
 }
 
-// Runs in the background, sending an 0x0D packet every 50 ms
+// Runs in the background, turning the player towards their look target, advancing the
+// physics simulation if it is enabled, and then sending whichever of packets 0x0A to 0x0D
+// describes their movement, every 50 ms.
 func (client *Client) PositionSender() {
 	ticker := time.NewTicker(time.Millisecond * 50)
 
@@ -448,15 +446,18 @@ func (client *Client) PositionSender() {
 			return
 
 		case <-ticker.C:
-			/*
-				if !client.PlayerOnGround && client.serverMode == 0 {
-					client.PlayerY -= 0.2
-				}
-			*/
+			client.playerMutex.Lock()
+			client.turn()
+			client.playerMutex.Unlock()
 
-			//fmt.Printf("sending...\n")
+			if client.Physics {
+				client.PhysicsTick()
+			}
+
+			client.playerMutex.Lock()
+			err := client.sendMovement()
+			client.playerMutex.Unlock()
 
-			err := client.SendPacket(0x0D, client.PlayerX, client.PlayerY, client.PlayerStance, client.PlayerZ, client.PlayerYaw, client.PlayerPitch, client.PlayerOnGround)
 			if err != nil {
 				client.ErrChan <- err
 				continue
@@ -493,6 +494,13 @@ func (client *Client) LeaveNoKick() (err error) {
 	// Wait for a reply
 	<-client.stopPositionSender
 
+	if client.DebugWriter != nil {
+		fmt.Fprintf(client.DebugWriter, "Stopping chat sender...\n")
+	}
+
+	client.stopChatSender <- struct{}{}
+	<-client.stopChatSender
+
 	if client.DebugWriter != nil {
 		fmt.Fprintf(client.DebugWriter, "Closing connection...\n")
 	}
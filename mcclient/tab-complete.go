@@ -0,0 +1,60 @@
+package mcclient
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// How long TabComplete waits for the server to reply.
+const TabCompleteTimeout = time.Second * 5
+
+// Asks the server how the text being typed into chat could be completed, as when
+// pressing Tab. Text starting with "/" completes command names and arguments; otherwise
+// the last word is completed as a player name. Only one request is made at a time. The
+// text may be no longer than MaxChatLength, as servers kick clients that send more.
+func (client *Client) TabComplete(text string) (completions []string, err error) {
+	if utf8.RuneCountInString(text) > MaxChatLength {
+		return nil, fmt.Errorf("Text to complete is longer than %d characters", MaxChatLength)
+	}
+
+	client.tabCompleteMutex.Lock()
+	defer client.tabCompleteMutex.Unlock()
+
+	// Discard a reply that nobody asked for.
+	select {
+	case <-client.tabCompleteReply:
+	default:
+	}
+
+	err = client.SendPacket(0xCB, text)
+	if err != nil {
+		return nil, err
+	}
+
+	var reply string
+
+	select {
+	case reply = <-client.tabCompleteReply:
+
+	case <-time.After(TabCompleteTimeout):
+		client.tabCompleteReplyMutex.Lock()
+		defer client.tabCompleteReplyMutex.Unlock()
+
+		// Take the reply if it has arrived since the timeout. Otherwise it must be dropped
+		// when it does, rather than taken as the reply to a later request.
+		select {
+		case reply = <-client.tabCompleteReply:
+		default:
+			client.tabCompleteLate++
+			return nil, fmt.Errorf("Timed out waiting for tab completions")
+		}
+	}
+
+	if reply == "" {
+		return nil, nil
+	}
+
+	return strings.Split(reply, "\x00"), nil
+}
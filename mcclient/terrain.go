@@ -0,0 +1,173 @@
+package mcclient
+
+import (
+	"github.com/kierdavis/mc/resources"
+)
+
+// Mobs hostile to players spawn at light levels no higher than this.
+const MaxSpawnLight = 7
+
+// The amount sky light is reduced by at midnight in clear weather.
+const NightSkyDarkening = 11
+
+// Blocks that are solid but that mobs cannot spawn on: leaves, glass, glass panes and
+// slabs. Slabs only prevent spawning when in the bottom half of the block, but this is
+// not checked.
+var noSpawnBlocks = []uint16{18, 20, 44, 102, 126}
+
+// Returns the Y coordinate of the highest non-air block in each column of blocks (indexed
+// by z*16 + x) and of the highest solid block, or -1 where there is none.
+func (column *Column) HeightMaps() (highest [256]int, highestSolid [256]int) {
+	for i := range highest {
+		highest[i] = -1
+		highestSolid[i] = -1
+	}
+
+	remaining := 256
+
+	for cy := 15; cy >= 0 && remaining > 0; cy-- {
+		chunk, ok := column.Chunks[cy]
+		if !ok || chunk.BlockTypes == nil {
+			continue
+		}
+
+		for y := 15; y >= 0; y-- {
+			for i := 0; i < 256; i++ {
+				if highestSolid[i] >= 0 {
+					continue
+				}
+
+				block := chunk.GetBlock(i&15, y, i>>4)
+				if block.IsAir() {
+					continue
+				}
+
+				if highest[i] < 0 {
+					highest[i] = cy*16 + y
+				}
+
+				if block.Is(resources.Solid) {
+					highestSolid[i] = cy*16 + y
+					remaining--
+				}
+			}
+		}
+	}
+
+	return highest, highestSolid
+}
+
+// Returns the Y coordinates of the highest non-air and highest solid blocks at a position
+// relative to the column's minimum corner, or -1 where there is none.
+func (column *Column) Height(x int, z int) (highest int, highestSolid int) {
+	highest, highestSolid = -1, -1
+
+	for y := 255; y >= 0 && highestSolid < 0; y-- {
+		block, _ := column.GetBlock(x, y, z)
+		if block.IsAir() {
+			continue
+		}
+
+		if highest < 0 {
+			highest = y
+		}
+
+		if block.Is(resources.Solid) {
+			highestSolid = y
+		}
+	}
+
+	return highest, highestSolid
+}
+
+// Returns the biome at a position relative to the column's minimum corner, or false if
+// the column has no biome data or the biome is unknown.
+func (column *Column) Biome(x int, z int) (biome resources.Biome, ok bool) {
+	if column.Biomes == nil {
+		return resources.Biome{}, false
+	}
+
+	return resources.BiomeByID(column.Biomes[z<<4|x])
+}
+
+// Returns the light level of the block: the greater of its block light and its sky light
+// less skyDarkening, which is 0 at noon and NightSkyDarkening at midnight.
+func (block Block) Light(skyDarkening int) (level int) {
+	level = int(block.SkyLight) - skyDarkening
+	if int(block.BlockLight) > level {
+		level = int(block.BlockLight)
+	}
+
+	if level < 0 {
+		level = 0
+	}
+
+	return level
+}
+
+// Reports whether a player could stand with their feet in the block: it and the block
+// above are free of solid and dangerous blocks, and it rests on a solid block that will
+// not hurt them.
+func (snapshot *Snapshot) IsSafeStanding(x int, y int, z int) (safe bool) {
+	below, ok1 := snapshot.GetBlock(x, y-1, z)
+	feet, ok2 := snapshot.GetBlock(x, y, z)
+	head, ok3 := snapshot.GetBlock(x, y+1, z)
+
+	if !ok1 || !ok2 || !ok3 {
+		return false
+	}
+
+	return below.Is(resources.Solid) && !below.Is(resources.Dangerous) &&
+		!feet.Is(resources.Solid|resources.Dangerous) && !head.Is(resources.Solid|resources.Dangerous)
+}
+
+// Reports whether a two-block-tall hostile mob such as a zombie could spawn with its feet
+// in the block, given the current sky darkening.
+func (snapshot *Snapshot) IsSpawnable(x int, y int, z int, skyDarkening int) (spawnable bool) {
+	feet, ok := snapshot.GetBlock(x, y, z)
+	return ok && snapshot.spawnable(x, y, z, feet, skyDarkening)
+}
+
+// Like IsSpawnable, for a block already read.
+func (snapshot *Snapshot) spawnable(x int, y int, z int, feet Block, skyDarkening int) (spawnable bool) {
+	below, ok1 := snapshot.GetBlock(x, y-1, z)
+	head, ok2 := snapshot.GetBlock(x, y+1, z)
+
+	if !ok1 || !ok2 {
+		return false
+	}
+
+	if !below.Is(resources.Solid) || MatchIDs(noSpawnBlocks...)(x, y-1, z, below) {
+		return false
+	}
+
+	if feet.Is(resources.Solid|resources.Liquid) || head.Is(resources.Solid|resources.Liquid) {
+		return false
+	}
+
+	return feet.Light(skyDarkening) <= MaxSpawnLight
+}
+
+// Returns every position within a box where hostile mobs could spawn.
+func (snapshot *Snapshot) FindSpawnable(corner1 BlockCoord, corner2 BlockCoord, skyDarkening int) (found []FoundBlock) {
+	return snapshot.FindBlocks(corner1, corner2, func(x int, y int, z int, block Block) bool {
+		return !block.Is(resources.Solid) && block.Light(skyDarkening) <= MaxSpawnLight &&
+			snapshot.spawnable(x, y, z, block, skyDarkening)
+	})
+}
+
+// Returns the nearest position to centre, within radius blocks, where a player could
+// stand.
+func (snapshot *Snapshot) NearestSafeStanding(centre BlockCoord, radius int) (found FoundBlock, ok bool) {
+	return snapshot.NearestBlock(centre, radius, func(x int, y int, z int, block Block) bool {
+		return !block.Is(resources.Solid) && snapshot.IsSafeStanding(x, y, z)
+	})
+}
+
+func (client *Client) FindSpawnable(corner1 BlockCoord, corner2 BlockCoord, skyDarkening int) (found []FoundBlock) {
+	return client.World.Snapshot().FindSpawnable(corner1, corner2, skyDarkening)
+}
+
+func (client *Client) NearestSafeStanding(centre BlockCoord, radius int) (found FoundBlock, ok bool) {
+	return client.World.Snapshot().NearestSafeStanding(centre, radius)
+}
@@ -0,0 +1,54 @@
+package mcclient
+
+import (
+	"testing"
+)
+
+// Mobs spawn on the surface under an open sky only at night, and under a roof at any
+// time, with the sky light of the missing chunks above the terrain filled in.
+func TestFindSpawnableOpenSky(t *testing.T) {
+	// Stone at y = 15, and a stone roof at y = 40 over z = 0. Chunk 1, where the mobs'
+	// feet go, is missing.
+	types := make([]byte, 4096)
+	for i := 15 << 8; i < 16<<8; i++ {
+		types[i] = 1
+	}
+
+	roof := make([]byte, 4096)
+	for x := 0; x < 16; x++ {
+		roof[x|8<<8] = 1
+	}
+
+	world := NewWorld()
+	world.SetColumn(ColumnCoord{0, 0}, &Column{Chunks: map[int]*Chunk{0: {BlockTypes: types}, 2: {BlockTypes: roof}}})
+	snapshot := world.Snapshot()
+
+	tests := []struct {
+		skyDarkening int
+		spawnable    int
+	}{
+		{0, 16},
+		{NightSkyDarkening, 256},
+	}
+
+	for _, test := range tests {
+		found := snapshot.FindSpawnable(BlockCoord{0, 0, 0}, BlockCoord{15, 30, 15}, test.skyDarkening)
+		if len(found) != test.spawnable {
+			t.Errorf("Sky darkening %d: found %d spawnable positions, expected %d", test.skyDarkening, len(found), test.spawnable)
+		}
+
+		for _, f := range found {
+			if f.Y != 16 || (test.skyDarkening == 0 && f.Z != 0) {
+				t.Errorf("Sky darkening %d: (%d, %d, %d) should not be spawnable", test.skyDarkening, f.X, f.Y, f.Z)
+			}
+
+			if !snapshot.IsSpawnable(f.X, f.Y, f.Z, test.skyDarkening) {
+				t.Errorf("IsSpawnable disagrees with FindSpawnable at (%d, %d, %d)", f.X, f.Y, f.Z)
+			}
+		}
+	}
+
+	if snapshot.IsSpawnable(3, 16, 3, 0) {
+		t.Errorf("Open sky is spawnable at noon")
+	}
+}
@@ -0,0 +1,342 @@
+package mcclient
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// The stored world, safe for use from several goroutines. Columns and chunks are never
+// modified once they have been stored: every change builds a copy of the affected
+// column and chunks and swaps it in, so a reader holding a *Column or *Chunk always
+// sees a consistent state without holding a lock. Code that stores columns with
+// SetColumn must not modify them afterwards either.
+//
+// The number of columns kept in memory can be bounded with MaxColumns; see Evict.
+type World struct {
+	// The most columns to keep in memory, or 0 for no limit.
+	MaxColumns int
+
+	// If set, columns that are evicted or unloaded by the server are written to files in
+	// this directory, and read back by GetColumn when next asked for. Such columns may be
+	// out of date, as the server sends no changes for them. Snapshots only include columns
+	// held in memory.
+	SpillDir string
+
+	mutex      sync.RWMutex
+	columns    map[ColumnCoord]*Column
+	spilled    map[ColumnCoord]uint64 // The spill number of each column's file on disk.
+	spills     uint64
+	generation uint64
+}
+
+// A change to a single block, as sent in block change packets.
+type BlockChange struct {
+	X, Y, Z  int
+	ID       uint16
+	Metadata byte
+}
+
+// A read-only view of the world at one moment, for reads spanning several chunks that
+// must not see changes made part-way through.
+type Snapshot struct {
+	columns map[ColumnCoord]*Column
+}
+
+func NewWorld() (world *World) {
+	return &World{
+		columns: make(map[ColumnCoord]*Column),
+		spilled: make(map[ColumnCoord]uint64),
+	}
+}
+
+// Returns a stored column. A column that has been spilled to disk is read back into
+// memory, where it counts towards MaxColumns at the next Evict; if reading it fails, it
+// is treated as missing and the file is deleted.
+func (world *World) GetColumn(coord ColumnCoord) (column *Column, ok bool) {
+	for {
+		world.mutex.RLock()
+		column, ok = world.columns[coord]
+		spill, spilled := world.spilled[coord]
+		world.mutex.RUnlock()
+
+		if ok || !spilled {
+			return column, ok
+		}
+
+		loaded, err := readColumnFile(world.spillFilename(coord))
+
+		world.mutex.Lock()
+
+		// The file is read without the lock, so the column may have been stored, deleted
+		// or spilled again in the meantime. Only the file we read may be installed; if it
+		// has changed, look again.
+		if world.spilled[coord] != spill {
+			world.mutex.Unlock()
+			continue
+		}
+
+		// A file that cannot be read will not get better, so forget it rather than reading
+		// it again on every call.
+		if err != nil {
+			delete(world.spilled, coord)
+			os.Remove(world.spillFilename(coord))
+			world.mutex.Unlock()
+			return nil, false
+		}
+
+		world.columns[coord] = loaded
+		delete(world.spilled, coord)
+		world.mutex.Unlock()
+
+		return loaded, true
+	}
+}
+
+// Stores a column, replacing any previous column with the same coordinates.
+func (world *World) SetColumn(coord ColumnCoord, column *Column) {
+	world.mutex.Lock()
+	world.columns[coord] = column
+	delete(world.spilled, coord)
+	world.generation++
+	world.mutex.Unlock()
+}
+
+// Forgets a column, including any copy spilled to disk.
+func (world *World) DeleteColumn(coord ColumnCoord) {
+	world.mutex.Lock()
+	delete(world.columns, coord)
+	delete(world.spilled, coord)
+	world.generation++
+	world.mutex.Unlock()
+}
+
+// Removes a column from memory, spilling it to disk if SpillDir is set.
+func (world *World) UnloadColumn(coord ColumnCoord) (err error) {
+	world.mutex.Lock()
+	defer world.mutex.Unlock()
+
+	return world.unload(coord)
+}
+
+// Removes the columns furthest from centre until no more than MaxColumns remain, spilling
+// them to disk if SpillDir is set. The client calls this whenever it stores a column,
+// with the column the player is in.
+func (world *World) Evict(centre ColumnCoord) (err error) {
+	world.mutex.Lock()
+	defer world.mutex.Unlock()
+
+	if world.MaxColumns <= 0 || len(world.columns) <= world.MaxColumns {
+		return nil
+	}
+
+	coords := make([]ColumnCoord, 0, len(world.columns))
+	for coord := range world.columns {
+		coords = append(coords, coord)
+	}
+
+	sort.Slice(coords, func(i, j int) bool {
+		return coords[i].distanceSq(centre) > coords[j].distanceSq(centre)
+	})
+
+	for _, coord := range coords[:len(coords)-world.MaxColumns] {
+		err = world.unload(coord)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Removes a column from memory. The caller must hold the write lock.
+func (world *World) unload(coord ColumnCoord) (err error) {
+	column, ok := world.columns[coord]
+	if !ok {
+		return nil
+	}
+
+	if world.SpillDir != "" {
+		err = os.MkdirAll(world.SpillDir, 0755)
+		if err != nil {
+			return err
+		}
+
+		err = writeColumnFile(world.spillFilename(coord), coord, column)
+		if err != nil {
+			return err
+		}
+
+		world.spills++
+		world.spilled[coord] = world.spills
+	}
+
+	delete(world.columns, coord)
+	world.generation++
+	return nil
+}
+
+func (world *World) spillFilename(coord ColumnCoord) (filename string) {
+	return filepath.Join(world.SpillDir, fmt.Sprintf("c.%d.%d.dat", coord.X, coord.Z))
+}
+
+// Returns a number that changes whenever a block or column is changed, so that code
+// relying on the state of the world can tell cheaply when to check it again.
+func (world *World) Generation() (generation uint64) {
+	world.mutex.RLock()
+	generation = world.generation
+	world.mutex.RUnlock()
+
+	return generation
+}
+
+// Returns the number of columns held in memory.
+func (world *World) Len() (n int) {
+	world.mutex.RLock()
+	n = len(world.columns)
+	world.mutex.RUnlock()
+
+	return n
+}
+
+func (world *World) GetChunk(cx int, cy int, cz int) (chunk *Chunk, ok bool) {
+	column, ok := world.GetColumn(ColumnCoord{cx, cz})
+	if !ok {
+		return nil, false
+	}
+
+	return column.GetChunk(cy)
+}
+
+func (world *World) GetBlock(x int, y int, z int) (block Block, ok bool) {
+	column, ok := world.GetColumn(ColumnCoord{x >> 4, z >> 4})
+	if !ok || y < 0 || y >= 256 {
+		return Block{}, false
+	}
+
+	return column.GetBlock(x&15, y, z&15)
+}
+
+// Changes the ID and metadata of a single block, keeping its light levels. It returns
+// false if the block's column is not loaded.
+func (world *World) SetBlock(x int, y int, z int, block Block) (ok bool) {
+	return world.SetBlocks([]BlockChange{{x, y, z, block.ID, block.Metadata}}) == 1
+}
+
+// Applies several block changes at once; readers see either none or all of them. Changes
+// to blocks in columns that are not loaded are skipped. It returns the number of changes
+// applied.
+func (world *World) SetBlocks(changes []BlockChange) (applied int) {
+	type chunkCoord struct {
+		column ColumnCoord
+		cy     int
+	}
+
+	columns := make(map[ColumnCoord]*Column)
+	chunks := make(map[chunkCoord]*Chunk)
+
+	world.mutex.Lock()
+	defer world.mutex.Unlock()
+
+	for _, change := range changes {
+		if change.Y < 0 || change.Y >= 256 {
+			continue
+		}
+
+		coord := ColumnCoord{change.X >> 4, change.Z >> 4}
+
+		column, ok := columns[coord]
+		if !ok {
+			column, ok = world.columns[coord]
+			if !ok {
+				continue
+			}
+
+			column = column.copy()
+			columns[coord] = column
+		}
+
+		cc := chunkCoord{coord, change.Y >> 4}
+
+		chunk, ok := chunks[cc]
+		if !ok {
+			old, present := column.Chunks[cc.cy]
+			chunk = old.copy()
+
+			// Keep the sky light a missing chunk is read with.
+			if !present {
+				chunk.SkyLight = column.missingSkyLight(cc.cy)
+			}
+
+			column.Chunks[cc.cy] = chunk
+			chunks[cc] = chunk
+		}
+
+		chunk.setBlock(change.X&15, change.Y&15, change.Z&15, change.ID, change.Metadata)
+		applied++
+	}
+
+	for coord, column := range columns {
+		world.columns[coord] = column
+	}
+
+	if applied > 0 {
+		world.generation++
+	}
+
+	return applied
+}
+
+// Returns a view of the world as it is now. Taking a snapshot copies only the table of
+// columns, so it is cheap enough to do once per search.
+func (world *World) Snapshot() (snapshot *Snapshot) {
+	world.mutex.RLock()
+	defer world.mutex.RUnlock()
+
+	columns := make(map[ColumnCoord]*Column, len(world.columns))
+	for coord, column := range world.columns {
+		columns[coord] = column
+	}
+
+	return &Snapshot{columns}
+}
+
+// Returns the coordinates of every column in the snapshot, in no particular order.
+func (snapshot *Snapshot) Coords() (coords []ColumnCoord) {
+	coords = make([]ColumnCoord, 0, len(snapshot.columns))
+	for coord := range snapshot.columns {
+		coords = append(coords, coord)
+	}
+
+	return coords
+}
+
+func (snapshot *Snapshot) GetColumn(coord ColumnCoord) (column *Column, ok bool) {
+	column, ok = snapshot.columns[coord]
+	return column, ok
+}
+
+func (snapshot *Snapshot) GetChunk(cx int, cy int, cz int) (chunk *Chunk, ok bool) {
+	column, ok := snapshot.columns[ColumnCoord{cx, cz}]
+	if !ok {
+		return nil, false
+	}
+
+	return column.GetChunk(cy)
+}
+
+func (snapshot *Snapshot) GetBlock(x int, y int, z int) (block Block, ok bool) {
+	column, ok := snapshot.GetColumn(ColumnCoord{x >> 4, z >> 4})
+	if !ok || y < 0 || y >= 256 {
+		return Block{}, false
+	}
+
+	return column.GetBlock(x&15, y, z&15)
+}
+
+// Returns the column the player is in. The caller must not hold playerMutex.
+func (client *Client) playerColumn() (coord ColumnCoord) {
+	return BlockCoordAt(client.Position()).Column()
+}
@@ -0,0 +1,291 @@
+package mcclient
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"os"
+	"sync"
+	"testing"
+)
+
+// A connection that reads packets from a buffer and discards anything written to it.
+type packetStream struct {
+	*bytes.Reader
+	io.Writer
+}
+
+// Encodes a packet, as the server would send it.
+func encodePacket(t *testing.T, id byte, fields ...interface{}) (packet []byte) {
+	buffer := new(bytes.Buffer)
+	buffer.WriteByte(id)
+
+	for _, field := range fields {
+		err := binary.Write(buffer, binary.BigEndian, field)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return buffer.Bytes()
+}
+
+// Encodes a ground-up map chunks packet (0x33) for a column whose bottom section is
+// filled with one type of block.
+func mapChunksPacket(t *testing.T, cx int32, cz int32, id byte) (packet []byte) {
+	data := new(bytes.Buffer)
+	zw := zlib.NewWriter(data)
+	zw.Write(bytes.Repeat([]byte{id}, 4096))
+	zw.Write(make([]byte, 2048))               // Metadata.
+	zw.Write(make([]byte, 2048))               // Block light.
+	zw.Write(bytes.Repeat([]byte{0xFF}, 2048)) // Sky light.
+	zw.Write(make([]byte, 256))                // Biomes.
+	zw.Close()
+
+	packet = encodePacket(t, 0x33, cx, cz, true, uint16(1), uint16(0), int32(data.Len()), int32(0))
+	return append(packet, data.Bytes()...)
+}
+
+// Encodes a multi block change packet (0x34) setting blocks in a column to one type.
+func multiBlockChangePacket(t *testing.T, cx int32, cz int32, id uint16, positions ...[3]int) (packet []byte) {
+	records := make([]uint32, len(positions))
+	for i, pos := range positions {
+		records[i] = uint32(pos[0])<<28 | uint32(pos[2])<<24 | uint32(pos[1])<<16 | uint32(id)<<4
+	}
+
+	return encodePacket(t, 0x34, cx, cz, int16(len(records)), int32(len(records)*4), records)
+}
+
+// Has the client receive and handle a packet.
+func receivePacket(t *testing.T, client *Client, packet []byte) {
+	client.conn = packetStream{bytes.NewReader(packet), ioutil.Discard}
+
+	id, err := client.RecvAnyPacket()
+	if err == nil {
+		err = client.dispatchPacket(id)
+	}
+
+	if err != nil {
+		t.Fatalf("Handling packet 0x%02X: %s", packet[0], err.Error())
+	}
+}
+
+// Readers on several goroutines must see each packet's changes in full or not at all
+// while the receiving goroutine applies them.
+func TestWorldConcurrentReadersAndPacketWriters(t *testing.T) {
+	client := &Client{StoreWorld: true, World: NewWorld()}
+
+	for cx := int32(0); cx < 2; cx++ {
+		receivePacket(t, client, encodePacket(t, 0x32, cx, int32(0), true))
+		receivePacket(t, client, mapChunksPacket(t, cx, 0, 1))
+	}
+
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+
+				// Both blocks are changed by the same packet.
+				snapshot := client.World.Snapshot()
+				a, _ := snapshot.GetBlock(3, 5, 3)
+				b, _ := snapshot.GetBlock(4, 5, 3)
+				if a.ID != b.ID {
+					t.Errorf("Snapshot saw half a multi block change: %d and %d", a.ID, b.ID)
+					return
+				}
+
+				block, ok := client.GetBlock(20, 0, 3)
+				if !ok || block.ID == 0 {
+					t.Errorf("Column replaced by a map chunks packet was missing or empty")
+					return
+				}
+
+				client.World.Generation()
+			}
+		}()
+	}
+
+	for i := 0; i < 500; i++ {
+		id := uint16(i%200 + 2)
+
+		receivePacket(t, client, multiBlockChangePacket(t, 0, 0, id, [3]int{3, 5, 3}, [3]int{4, 5, 3}))
+		receivePacket(t, client, encodePacket(t, 0x35, int32(20), uint8(1), int32(3), id, uint8(0)))
+
+		if i%50 == 0 {
+			receivePacket(t, client, mapChunksPacket(t, 1, 0, byte(id)))
+		}
+	}
+
+	close(stop)
+	wg.Wait()
+
+	block, _ := client.GetBlock(3, 5, 3)
+	if block.ID != 499%200+2 {
+		t.Errorf("Expected block type %d after the last change, got %d", 499%200+2, block.ID)
+	}
+}
+
+// Returns a column whose block at (0, 0, 0) has the given type.
+func markedColumn(id byte) (column *Column) {
+	types := make([]byte, 4096)
+	types[0] = id
+
+	return &Column{Chunks: map[int]*Chunk{0: {BlockTypes: types}}}
+}
+
+// Reading back a spilled column must not undo a store or delete made while the file was
+// being read.
+func TestWorldSpilledColumnsUnderConcurrentWrites(t *testing.T) {
+	world := NewWorld()
+	world.SpillDir = t.TempDir()
+	coord := ColumnCoord{0, 0}
+
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			var last uint16
+
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+
+				column, ok := world.GetColumn(coord)
+				if !ok {
+					continue
+				}
+
+				block, _ := column.GetBlock(0, 0, 0)
+				if block.ID < last {
+					t.Errorf("Column went back from version %d to %d", last, block.ID)
+					return
+				}
+
+				last = block.ID
+			}
+		}()
+	}
+
+	for i := 1; i <= 200; i++ {
+		world.SetColumn(coord, markedColumn(byte(i)))
+
+		err := world.UnloadColumn(coord)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	world.DeleteColumn(coord)
+
+	close(stop)
+	wg.Wait()
+
+	if _, ok := world.GetColumn(coord); ok {
+		t.Errorf("Deleted column came back")
+	}
+}
+
+// Every way of reading a chunk left out of a column must agree that it is lit by the sky
+// above the terrain and dark beneath it.
+func TestWorldMissingChunkSkyLight(t *testing.T) {
+	// Stone at y = 4 and, at (0, z) only, a roof at y = 40. Chunk 1 is missing.
+	types := make([]byte, 4096)
+	for i := 4 << 8; i < 5<<8; i++ {
+		types[i] = 1
+	}
+
+	roof := make([]byte, 4096)
+	for z := 0; z < 16; z++ {
+		roof[z<<4|8<<8] = 1
+	}
+
+	world := NewWorld()
+	world.SetColumn(ColumnCoord{0, 0}, &Column{Chunks: map[int]*Chunk{0: {BlockTypes: types}, 2: {BlockTypes: roof}}})
+
+	check := func(how string, x int, y int, z int, block Block) {
+		expected := byte(15)
+		if x == 0 && y < 40 {
+			expected = 0
+		}
+
+		if block.SkyLight != expected {
+			t.Errorf("%s: sky light at (%d, %d, %d) is %d, expected %d", how, x, y, z, block.SkyLight, expected)
+		}
+	}
+
+	for _, x := range []int{0, 5} {
+		block, _ := world.Snapshot().GetBlock(x, 20, 3)
+		check("GetBlock", x, 20, 3, block)
+	}
+
+	found := world.Snapshot().FindBlocks(BlockCoord{0, 16, 0}, BlockCoord{15, 31, 15}, func(int, int, int, Block) bool { return true })
+	if len(found) != 16*16*16 {
+		t.Fatalf("FindBlocks found %d blocks", len(found))
+	}
+
+	for _, f := range found {
+		check("FindBlocks", f.X, f.Y, f.Z, f.Block)
+	}
+
+	// Changing a block fills in the chunk with the sky light it was read with.
+	world.SetBlock(7, 20, 7, Block{ID: 1})
+
+	for _, x := range []int{0, 5} {
+		block, _ := world.Snapshot().GetBlock(x, 21, 3)
+		check("GetBlock after SetBlock", x, 21, 3, block)
+	}
+}
+
+// A spilled column whose file cannot be read is forgotten, along with the file.
+func TestWorldUnreadableSpillFile(t *testing.T) {
+	world := NewWorld()
+	world.SpillDir = t.TempDir()
+	coord := ColumnCoord{0, 0}
+
+	world.SetColumn(coord, markedColumn(1))
+
+	err := world.UnloadColumn(coord)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	filename := world.spillFilename(coord)
+
+	err = ioutil.WriteFile(filename, []byte("not a column"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := world.GetColumn(coord); ok {
+		t.Fatalf("Unreadable column was loaded")
+	}
+
+	if _, ok := world.spilled[coord]; ok {
+		t.Errorf("Unreadable column is still recorded as spilled")
+	}
+
+	if _, err := os.Stat(filename); !os.IsNotExist(err) {
+		t.Errorf("Unreadable spill file was not deleted: %v", err)
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"github.com/kierdavis/mc/mcquery"
+	"sync"
+	"time"
+)
+
+// Keeps one query client open per target so that each scrape does not need a fresh
+// handshake. The clients renew their challenge tokens once they are older than
+// ChallengeLifetime.
+type ConnCache struct {
+	ChallengeLifetime time.Duration
+	IdleTimeout       time.Duration
+
+	mutex   sync.Mutex
+	entries map[string]*connEntry
+}
+
+type connEntry struct {
+	client   *mcquery.Client
+	lastUsed time.Time
+}
+
+func NewConnCache(challengeLifetime time.Duration, idleTimeout time.Duration) (cache *ConnCache) {
+	return &ConnCache{
+		ChallengeLifetime: challengeLifetime,
+		IdleTimeout:       idleTimeout,
+		entries:           make(map[string]*connEntry),
+	}
+}
+
+func (cache *ConnCache) client(ctx context.Context, addr string) (client *mcquery.Client, err error) {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	e, ok := cache.entries[addr]
+	if !ok {
+		client, err = mcquery.DialContext(ctx, addr)
+		if err != nil {
+			return nil, err
+		}
+
+		client.ChallengeLifetime = cache.ChallengeLifetime
+
+		e = &connEntry{client: client}
+		cache.entries[addr] = e
+	}
+
+	e.lastUsed = time.Now()
+	return e.client, nil
+}
+
+// Performs a full stat query against addr, reusing a cached client and challenge where
+// possible.
+func (cache *ConnCache) FullStat(ctx context.Context, addr string) (stat *mcquery.Stat, err error) {
+	client, err := cache.client(ctx, addr)
+	if err != nil {
+		return nil, err
+	}
+
+	return client.FullStatContext(ctx)
+}
+
+// Closes clients that have not been used for IdleTimeout.
+func (cache *ConnCache) Sweep() {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	for addr, e := range cache.entries {
+		if time.Since(e.lastUsed) > cache.IdleTimeout {
+			e.client.Close()
+			delete(cache.entries, addr)
+		}
+	}
+}
+
+// Returns the number of open clients.
+func (cache *ConnCache) Len() (n int) {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	return len(cache.entries)
+}
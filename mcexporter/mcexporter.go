@@ -0,0 +1,151 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"github.com/kierdavis/mc/mcclient"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	listenP            = flag.String("listen", ":9225", "The address on which to serve metrics.")
+	challengeLifetimeP = flag.Duration("challenge-lifetime", time.Second*25, "How long a query challenge token is reused before a new handshake. Servers rotate tokens every 30 seconds.")
+	idleTimeoutP       = flag.Duration("idle-timeout", time.Minute*10, "How long an unused query connection is kept open.")
+)
+
+// Ensures an address has a port, defaulting to 25565.
+func withDefaultPort(addr string) (result string) {
+	if strings.Index(addr, ":") < 0 {
+		return addr + ":25565"
+	}
+
+	return addr
+}
+
+func main() {
+	flag.Parse()
+
+	cache := NewConnCache(*challengeLifetimeP, *idleTimeoutP)
+
+	go func() {
+		for range time.Tick(time.Minute) {
+			cache.Sweep()
+		}
+	}()
+
+	http.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		serveMetrics(w, r, cache)
+	})
+
+	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+
+		fmt.Fprintf(w, "<html><body><h1>mcexporter</h1><p>Probe a server with <a href=\"/metrics?target=localhost:25565\">/metrics?target=host:port</a>. Add &amp;query_target=host:port if the query port differs from the game port.</p></body></html>\n")
+	})
+
+	fmt.Printf("Serving metrics on %s\n", *listenP)
+
+	err := http.ListenAndServe(*listenP, nil)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err.Error())
+		os.Exit(1)
+	}
+}
+
+// Serves the exporter's own metrics, or, if a target parameter is given, probes that
+// server and serves its metrics.
+func serveMetrics(w http.ResponseWriter, r *http.Request, cache *ConnCache) {
+	m := NewMetrics()
+	target := r.URL.Query().Get("target")
+
+	if target == "" {
+		m.Gauge("mc_exporter_query_connections", "Number of cached query connections.", float64(cache.Len()), nil)
+
+	} else {
+		queryTarget := r.URL.Query().Get("query_target")
+		if queryTarget == "" {
+			queryTarget = target
+		}
+
+		probe(r.Context(), m, cache, withDefaultPort(target), withDefaultPort(queryTarget))
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	m.WriteTo(w)
+}
+
+// Runs the server list ping and a full stat query concurrently and records the results.
+func probe(ctx context.Context, m *Metrics, cache *ConnCache, addr string, queryAddr string) {
+	start := time.Now()
+
+	pingMetrics := NewMetrics()
+	queryMetrics := NewMetrics()
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+
+	go func() {
+		defer wg.Done()
+
+		pingCtx, cancel := context.WithTimeout(ctx, mcclient.ScanTimeout)
+		defer cancel()
+
+		pingStart := time.Now()
+		result, err := mcclient.ScanServerContext(pingCtx, addr)
+		pingDuration := time.Since(pingStart)
+
+		pingMetrics.Gauge("mc_ping_up", "Whether the server answered the server list ping.", boolValue(err == nil), nil)
+
+		if err == nil {
+			pingMetrics.Gauge("mc_ping_duration_seconds", "Round-trip time of the server list ping.", pingDuration.Seconds(), nil)
+			pingMetrics.Gauge("mc_ping_players_online", "Players online according to the server list ping.", float64(result.PlayersOnline), nil)
+			pingMetrics.Gauge("mc_ping_players_max", "Player limit according to the server list ping.", float64(result.PlayersMax), nil)
+		}
+	}()
+
+	go func() {
+		defer wg.Done()
+
+		queryStart := time.Now()
+		stat, err := cache.FullStat(ctx, queryAddr)
+		queryDuration := time.Since(queryStart)
+
+		queryMetrics.Gauge("mc_query_up", "Whether the server answered a full stat query.", boolValue(err == nil), nil)
+
+		if err == nil {
+			queryMetrics.Gauge("mc_query_duration_seconds", "Round-trip time of the full stat query, including any handshake.", queryDuration.Seconds(), nil)
+			queryMetrics.Gauge("mc_players_online", "Players online according to the query protocol.", float64(stat.NumPlayers), nil)
+			queryMetrics.Gauge("mc_players_max", "Player limit according to the query protocol.", float64(stat.MaxPlayers), nil)
+			queryMetrics.Gauge("mc_plugins", "Number of plugins reported by the server.", float64(len(stat.Plugins)), nil)
+			queryMetrics.Gauge("mc_server_info", "Constant 1, labelled with the server's version and software.", 1, map[string]string{
+				"version":    stat.Version,
+				"server_mod": stat.ServerMod,
+				"game_type":  stat.GameType,
+				"map":        stat.Map,
+			})
+		}
+	}()
+
+	wg.Wait()
+
+	merge(m, pingMetrics)
+	merge(m, queryMetrics)
+	m.Gauge("mc_probe_duration_seconds", "How long the probe took.", time.Since(start).Seconds(), nil)
+}
+
+// Appends the samples of src to dst.
+func merge(dst *Metrics, src *Metrics) {
+	for _, f := range src.families {
+		for _, s := range f.samples {
+			dst.add(f.name, f.help, f.typ, s.value, s.labels)
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// A set of metrics to be written in the Prometheus text exposition format.
+type Metrics struct {
+	families []*family
+	byName   map[string]*family
+}
+
+type family struct {
+	name    string
+	help    string
+	typ     string
+	samples []sample
+}
+
+type sample struct {
+	labels map[string]string
+	value  float64
+}
+
+func NewMetrics() (m *Metrics) {
+	return &Metrics{byName: make(map[string]*family)}
+}
+
+// Adds a gauge sample. Samples with the same name are grouped under a single HELP/TYPE
+// header, which is taken from the first call.
+func (m *Metrics) Gauge(name string, help string, value float64, labels map[string]string) {
+	m.add(name, help, "gauge", value, labels)
+}
+
+func (m *Metrics) add(name string, help string, typ string, value float64, labels map[string]string) {
+	f, ok := m.byName[name]
+	if !ok {
+		f = &family{name: name, help: help, typ: typ}
+		m.byName[name] = f
+		m.families = append(m.families, f)
+	}
+
+	f.samples = append(f.samples, sample{labels, value})
+}
+
+func (m *Metrics) WriteTo(w io.Writer) (n int64, err error) {
+	var b strings.Builder
+
+	for _, f := range m.families {
+		fmt.Fprintf(&b, "# HELP %s %s\n", f.name, escapeHelp(f.help))
+		fmt.Fprintf(&b, "# TYPE %s %s\n", f.name, f.typ)
+
+		for _, s := range f.samples {
+			b.WriteString(f.name)
+			writeLabels(&b, s.labels)
+			b.WriteByte(' ')
+			b.WriteString(formatValue(s.value))
+			b.WriteByte('\n')
+		}
+	}
+
+	nn, err := io.WriteString(w, b.String())
+	return int64(nn), err
+}
+
+func writeLabels(b *strings.Builder, labels map[string]string) {
+	if len(labels) == 0 {
+		return
+	}
+
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	b.WriteByte('{')
+
+	for i, name := range names {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+
+		fmt.Fprintf(b, "%s=\"%s\"", name, escapeLabelValue(labels[name]))
+	}
+
+	b.WriteByte('}')
+}
+
+func formatValue(v float64) (s string) {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+var helpEscaper = strings.NewReplacer("\\", "\\\\", "\n", "\\n")
+var labelEscaper = strings.NewReplacer("\\", "\\\\", "\n", "\\n", "\"", "\\\"")
+
+func escapeHelp(s string) (escaped string) {
+	return helpEscaper.Replace(s)
+}
+
+func escapeLabelValue(s string) (escaped string) {
+	return labelEscaper.Replace(s)
+}
+
+func boolValue(b bool) (v float64) {
+	if b {
+		return 1
+	}
+
+	return 0
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+)
+
+type ServerConfig struct {
+	Name      string // The name the server is shown and stored under.
+	Addr      string // The address of the game port, used for the server list ping.
+	QueryAddr string // The address of the query port, which is often the same as Addr.
+}
+
+// Ensures an address has a port, defaulting to 25565.
+func withDefaultPort(addr string) (result string) {
+	if strings.Index(addr, ":") < 0 {
+		return addr + ":25565"
+	}
+
+	return addr
+}
+
+// Parses a server given on the command line, in the form "addr" or "addr,queryaddr". The
+// server is named after its game address.
+func ParseServerArg(arg string) (server *ServerConfig, err error) {
+	addr := arg
+	queryAddr := arg
+
+	p := strings.Index(arg, ",")
+	if p >= 0 {
+		addr = arg[:p]
+		queryAddr = arg[p+1:]
+	}
+
+	if !validName(addr) {
+		return nil, fmt.Errorf("invalid server address %q", addr)
+	}
+
+	return &ServerConfig{
+		Name:      addr,
+		Addr:      withDefaultPort(addr),
+		QueryAddr: withDefaultPort(queryAddr),
+	}, nil
+}
+
+// Reads a list of servers from a file. Blank lines and lines starting with '#' are ignored.
+func ReadConfig(filename string) (servers []*ServerConfig, err error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	lineNum := 0
+
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) < 2 || len(fields) > 3 {
+			return nil, fmt.Errorf("%s:%d: expected '<name> <address> [<query address>]'", filename, lineNum)
+		}
+
+		server := &ServerConfig{
+			Name:      fields[0],
+			Addr:      withDefaultPort(fields[1]),
+			QueryAddr: withDefaultPort(fields[1]),
+		}
+
+		if len(fields) == 3 {
+			server.QueryAddr = withDefaultPort(fields[2])
+		}
+
+		if !validName(server.Name) {
+			return nil, fmt.Errorf("%s:%d: invalid server name %q", filename, lineNum, server.Name)
+		}
+
+		servers = append(servers, server)
+	}
+
+	err = scanner.Err()
+	if err != nil {
+		return nil, err
+	}
+
+	return servers, nil
+}
+
+// Reports whether a name is usable as part of a filename and URL path.
+func validName(name string) (ok bool) {
+	if name == "" || name == "." || name == ".." {
+		return false
+	}
+
+	for _, r := range name {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '.' || r == '-' || r == '_' || r == ':') {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,294 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const chartWidth = 600
+const chartHeight = 80
+
+type serverSummary struct {
+	Name      string  `json:"name"`
+	Addr      string  `json:"addr"`
+	QueryAddr string  `json:"query_addr"`
+	Latest    *Sample `json:"latest"`
+	State     State   `json:"state"`
+}
+
+type serverHistory struct {
+	Name    string    `json:"name"`
+	State   State     `json:"state"`
+	Samples []*Sample `json:"samples"`
+	Events  []*Event  `json:"events"`
+}
+
+type pageServer struct {
+	serverSummary
+	PlayersChart string
+	LatencyChart string
+	Events       []*Event
+}
+
+type handler struct {
+	servers []*ServerConfig
+	byName  map[string]*ServerConfig
+	store   *Store
+	mux     *http.ServeMux
+}
+
+// Returns an http.Handler serving the JSON API under /api/ and an HTML overview at /.
+func NewHandler(servers []*ServerConfig, store *Store) (h http.Handler) {
+	hh := &handler{
+		servers: servers,
+		byName:  make(map[string]*ServerConfig),
+		store:   store,
+		mux:     http.NewServeMux(),
+	}
+
+	for _, server := range servers {
+		hh.byName[server.Name] = server
+	}
+
+	hh.mux.HandleFunc("/api/servers", hh.serveServers)
+	hh.mux.HandleFunc("/api/servers/", hh.serveServer)
+	hh.mux.HandleFunc("/", hh.servePage)
+
+	return hh
+}
+
+func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.mux.ServeHTTP(w, r)
+}
+
+// Parses the "since" query parameter, which may be an RFC 3339 timestamp or a duration
+// counting back from now. It defaults to 24 hours ago.
+func parseSince(r *http.Request) (since time.Time, err error) {
+	s := r.URL.Query().Get("since")
+	if s == "" {
+		return time.Now().Add(-time.Hour * 24), nil
+	}
+
+	d, err := time.ParseDuration(s)
+	if err == nil {
+		return time.Now().Add(-d), nil
+	}
+
+	return time.Parse(time.RFC3339, s)
+}
+
+func (h *handler) summary(server *ServerConfig) (summary serverSummary) {
+	summary = serverSummary{
+		Name:      server.Name,
+		Addr:      server.Addr,
+		QueryAddr: server.QueryAddr,
+	}
+
+	summary.Latest, _ = h.store.Latest(server.Name)
+
+	history, ok := h.store.Get(server.Name, time.Now())
+	if ok {
+		summary.State = history.State
+	}
+
+	return summary
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+
+	err := json.NewEncoder(w).Encode(v)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// GET /api/servers: the latest sample and state of every server.
+func (h *handler) serveServers(w http.ResponseWriter, r *http.Request) {
+	summaries := make([]serverSummary, len(h.servers))
+
+	for i, server := range h.servers {
+		summaries[i] = h.summary(server)
+	}
+
+	writeJSON(w, summaries)
+}
+
+// GET /api/servers/<name>?since=<time>: the samples and events of one server.
+func (h *handler) serveServer(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(r.URL.Path, "/api/servers/")
+
+	server, ok := h.byName[name]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	since, err := parseSince(r)
+	if err != nil {
+		http.Error(w, "Bad 'since' parameter: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	history, ok := h.store.Get(server.Name, since)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	writeJSON(w, serverHistory{
+		Name:    server.Name,
+		State:   history.State,
+		Samples: history.Samples,
+		Events:  history.Events,
+	})
+}
+
+// GET /: an HTML overview with a chart of player counts and latency for each server.
+func (h *handler) servePage(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+
+	since, err := parseSince(r)
+	if err != nil {
+		http.Error(w, "Bad 'since' parameter: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	now := time.Now()
+	servers := make([]pageServer, len(h.servers))
+
+	for i, server := range h.servers {
+		servers[i].serverSummary = h.summary(server)
+
+		history, ok := h.store.Get(server.Name, since)
+		if !ok {
+			continue
+		}
+
+		servers[i].PlayersChart = chartPoints(history.Samples, since, now, func(sample *Sample) (v float64, max float64) {
+			return float64(sample.PlayersOnline), float64(sample.PlayersMax)
+		})
+
+		servers[i].LatencyChart = chartPoints(history.Samples, since, now, func(sample *Sample) (v float64, max float64) {
+			return sample.Latency, 0
+		})
+
+		// Most recent first.
+		for j := len(history.Events) - 1; j >= 0 && len(servers[i].Events) < 50; j-- {
+			servers[i].Events = append(servers[i].Events, history.Events[j])
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+
+	err = pageTemplate.Execute(w, map[string]interface{}{
+		"Servers": servers,
+		"Since":   since,
+		"Width":   chartWidth,
+		"Height":  chartHeight,
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// Builds the points attribute of an SVG polyline plotting a value over time. The vertical
+// scale is the largest of the values and the maxima returned by f. Samples from when the
+// server was down are plotted as zero.
+func chartPoints(samples []*Sample, start time.Time, end time.Time, f func(*Sample) (float64, float64)) (points string) {
+	scale := 1.0
+
+	for _, sample := range samples {
+		v, max := f(sample)
+
+		if v > scale {
+			scale = v
+		}
+
+		if max > scale {
+			scale = max
+		}
+	}
+
+	span := float64(end.Sub(start))
+	if span <= 0 {
+		return ""
+	}
+
+	parts := make([]string, 0, len(samples))
+
+	for _, sample := range samples {
+		v := 0.0
+		if sample.Up {
+			v, _ = f(sample)
+		}
+
+		x := float64(sample.Time.Sub(start)) / span * chartWidth
+		y := chartHeight - v/scale*chartHeight
+		parts = append(parts, fmt.Sprintf("%.1f,%.1f", x, y))
+	}
+
+	return strings.Join(parts, " ")
+}
+
+var pageTemplate = template.Must(template.New("page").Funcs(template.FuncMap{
+	"time": func(t time.Time) string {
+		return t.Format("2006-01-02 15:04:05")
+	},
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>mcmonitor</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+.server { margin-bottom: 2em; }
+.up { color: #080; }
+.down { color: #c00; }
+svg { background: #f4f4f4; display: block; margin: 0.5em 0; }
+polyline { fill: none; stroke-width: 1.5; }
+.players polyline { stroke: #36c; }
+.latency polyline { stroke: #c63; }
+ul.events { max-height: 12em; overflow-y: auto; font-size: 0.9em; }
+</style>
+</head>
+<body>
+<h1>mcmonitor</h1>
+<p>Showing history since {{time .Since}}.</p>
+{{range .Servers}}
+<div class="server">
+<h2>{{.Name}} <small>{{.Addr}}</small></h2>
+{{with .Latest}}
+<p>
+{{if .Up}}<span class="up">Up</span>{{else}}<span class="down">Down</span>{{end}}
+&middot; {{.PlayersOnline}}/{{.PlayersMax}} players
+{{if .Up}}&middot; {{printf "%.0f" .Latency}} ms{{end}}
+{{if .Version}}&middot; {{.Version}}{{end}}
+{{if .MOTD}}&middot; {{.MOTD}}{{end}}
+{{if .Error}}<br><small>{{.Error}}</small>{{end}}
+</p>
+{{else}}
+<p>Not polled yet.</p>
+{{end}}
+<div class="players">Players<svg width="{{$.Width}}" height="{{$.Height}}"><polyline points="{{.PlayersChart}}"/></svg></div>
+<div class="latency">Latency<svg width="{{$.Width}}" height="{{$.Height}}"><polyline points="{{.LatencyChart}}"/></svg></div>
+{{if .State.Players}}<p>Online: {{range $i, $p := .State.Players}}{{if $i}}, {{end}}{{$p}}{{end}}</p>{{end}}
+{{if .State.Plugins}}<p>Plugins: {{range $i, $p := .State.Plugins}}{{if $i}}, {{end}}{{$p}}{{end}}</p>{{end}}
+{{if .Events}}
+<ul class="events">
+{{range .Events}}<li>{{time .Time}} {{.Type}} {{.Subject}}</li>
+{{end}}
+</ul>
+{{end}}
+</div>
+{{end}}
+</body>
+</html>
+`))
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+)
+
+var (
+	configP    = flag.String("config", "", "A file listing the servers to monitor, one per line as '<name> <address> [<query address>]'.")
+	dataP      = flag.String("data", "mcmonitor-data", "The directory in which the history of each server is stored.")
+	listenP    = flag.String("listen", ":8080", "The address on which to serve the HTTP interface.")
+	intervalP  = flag.Duration("interval", time.Minute, "How often each server is polled.")
+	retentionP = flag.Duration("retention", time.Hour*24*7, "How long history is kept for.")
+	timeoutP   = flag.Duration("timeout", time.Second*10, "How long each poll of a server may take, covering both the server list ping and the query.")
+)
+
+func main() {
+	flag.Parse()
+
+	var servers []*ServerConfig
+	var err error
+
+	if *configP != "" {
+		servers, err = ReadConfig(*configP)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %s\n", err.Error())
+			os.Exit(1)
+		}
+	}
+
+	for _, arg := range flag.Args() {
+		server, err := ParseServerArg(arg)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %s\n", err.Error())
+			os.Exit(2)
+		}
+
+		servers = append(servers, server)
+	}
+
+	if len(servers) == 0 {
+		fmt.Fprintf(os.Stderr, "usage: %s [options] [<host[:port][,queryhost[:port]]> ...]\n\nAt least one server must be given, either as an argument or in the file named by -config.\n", os.Args[0])
+		os.Exit(2)
+	}
+
+	store, err := OpenStore(*dataP, *retentionP)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err.Error())
+		os.Exit(1)
+	}
+
+	defer store.Close()
+
+	for _, server := range servers {
+		err = store.Load(server.Name)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: loading history for %s: %s\n", server.Name, err.Error())
+			os.Exit(1)
+		}
+	}
+
+	monitor := &Monitor{
+		Servers:  servers,
+		Store:    store,
+		Interval: *intervalP,
+		Timeout:  *timeoutP,
+	}
+
+	go monitor.Run()
+
+	fmt.Printf("Monitoring %d server(s), serving on %s\n", len(servers), *listenP)
+
+	err = http.ListenAndServe(*listenP, NewHandler(servers, store))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err.Error())
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/kierdavis/mc/mcclient"
+	"github.com/kierdavis/mc/mcquery"
+	"os"
+	"sync"
+	"time"
+)
+
+// Periodically polls a set of servers and records the results in a store.
+type Monitor struct {
+	Servers  []*ServerConfig
+	Store    *Store
+	Interval time.Duration
+	Timeout  time.Duration // How long each poll of a server may take, ping and query together. Defaults to mcclient.ScanTimeout.
+}
+
+// Polls every server once per interval, forever.
+func (monitor *Monitor) Run() {
+	ticker := time.NewTicker(monitor.Interval)
+
+	for {
+		monitor.PollAll()
+		<-ticker.C
+	}
+}
+
+// Polls every server concurrently and waits for all of them to finish.
+func (monitor *Monitor) PollAll() {
+	var wg sync.WaitGroup
+
+	for _, server := range monitor.Servers {
+		wg.Add(1)
+
+		go func(server *ServerConfig) {
+			defer wg.Done()
+			monitor.Poll(server)
+		}(server)
+	}
+
+	wg.Wait()
+}
+
+// Polls a single server with both the server list ping and the query protocol.
+func (monitor *Monitor) Poll(server *ServerConfig) {
+	sample := &Sample{Time: time.Now()}
+
+	timeout := monitor.Timeout
+	if timeout <= 0 {
+		timeout = mcclient.ScanTimeout
+	}
+
+	// One deadline covers both, so that an unresponsive query port cannot hold up the poll
+	// for longer than an unresponsive server.
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	start := time.Now()
+	result, err := mcclient.ScanServerContext(ctx, server.Addr)
+	if err == nil {
+		sample.Up = true
+		sample.Latency = milliseconds(time.Since(start))
+		sample.PlayersOnline = result.PlayersOnline
+		sample.PlayersMax = result.PlayersMax
+		sample.MOTD = mcclient.NoEscapes(result.MOTD)
+
+	} else {
+		sample.Error = err.Error()
+	}
+
+	var players, plugins []string
+
+	start = time.Now()
+	stat, err := mcquery.FullStatContext(ctx, server.QueryAddr)
+	if err == nil {
+		sample.QueryOK = true
+		sample.QueryLatency = milliseconds(time.Since(start))
+		sample.Version = stat.Version
+		players = stat.Players
+		plugins = stat.Plugins
+
+		if !sample.Up {
+			// The query port is enough to tell that the server is up.
+			sample.Up = true
+			sample.PlayersOnline = stat.NumPlayers
+			sample.PlayersMax = stat.MaxPlayers
+			sample.MOTD = mcclient.NoEscapes(stat.MOTD)
+		}
+
+	} else if sample.Error == "" {
+		sample.Error = "query: " + err.Error()
+	}
+
+	events, err := monitor.Store.Record(server.Name, sample, players, plugins)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: recording sample for %s: %s\n", server.Name, err.Error())
+		return
+	}
+
+	for _, event := range events {
+		if event.Subject != "" {
+			fmt.Printf("%s %s: %s %s\n", event.Time.Format(time.RFC3339), server.Name, event.Type, event.Subject)
+		} else {
+			fmt.Printf("%s %s: %s\n", event.Time.Format(time.RFC3339), server.Name, event.Type)
+		}
+	}
+}
+
+func milliseconds(d time.Duration) (ms float64) {
+	return float64(d) / float64(time.Millisecond)
+}
@@ -0,0 +1,501 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// A single poll of a server.
+type Sample struct {
+	Time          time.Time `json:"time"`
+	Up            bool      `json:"up"`                   // Whether the server answered the server list ping.
+	Latency       float64   `json:"latency_ms,omitempty"` // Round-trip time of the server list ping, in milliseconds.
+	PlayersOnline int       `json:"players_online"`
+	PlayersMax    int       `json:"players_max"`
+	MOTD          string    `json:"motd,omitempty"`
+	QueryOK       bool      `json:"query_ok"`                   // Whether the query port answered a full stat.
+	QueryLatency  float64   `json:"query_latency_ms,omitempty"` // Round-trip time of the full stat, in milliseconds.
+	Version       string    `json:"version,omitempty"`
+	Error         string    `json:"error,omitempty"`
+}
+
+const (
+	EventUp            = "up"
+	EventDown          = "down"
+	EventJoin          = "join"
+	EventLeave         = "leave"
+	EventPluginAdded   = "plugin_added"
+	EventPluginRemoved = "plugin_removed"
+)
+
+// A change observed between two polls of a server.
+type Event struct {
+	Time    time.Time `json:"time"`
+	Type    string    `json:"type"`
+	Subject string    `json:"subject,omitempty"` // The player or plugin concerned, if any.
+}
+
+// The set of players and plugins last seen on a server, which later polls are compared
+// against to generate events.
+type State struct {
+	UpKnown bool     `json:"up_known"` // Whether the server has been polled before.
+	Up      bool     `json:"up"`
+	Known   bool     `json:"known"` // Whether the server has ever answered a full stat.
+	Players []string `json:"players"`
+	Plugins []string `json:"plugins"`
+}
+
+// One line of a history file. Exactly one field is set.
+type record struct {
+	Sample *Sample `json:"sample,omitempty"`
+	Event  *Event  `json:"event,omitempty"`
+	State  *State  `json:"state,omitempty"`
+}
+
+// The in-memory history of one server, backed by an append-only JSON-lines file.
+type History struct {
+	Samples []*Sample
+	Events  []*Event
+	State   State
+
+	file    *os.File
+	expired int
+}
+
+// Stores the history of each monitored server under a directory.
+type Store struct {
+	Dir       string
+	Retention time.Duration
+
+	mutex     sync.RWMutex
+	histories map[string]*History
+}
+
+func OpenStore(dir string, retention time.Duration) (store *Store, err error) {
+	err = os.MkdirAll(dir, 0755)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Store{
+		Dir:       dir,
+		Retention: retention,
+		histories: make(map[string]*History),
+	}, nil
+}
+
+func (store *Store) filename(name string) (filename string) {
+	return filepath.Join(store.Dir, name+".jsonl")
+}
+
+// Reads the history of a server from disk, discarding anything older than the retention
+// period, and opens its file for appending.
+func (store *Store) Load(name string) (err error) {
+	history := new(History)
+	cutoff := time.Now().Add(-store.Retention)
+
+	f, err := os.Open(store.filename(name))
+	if err == nil {
+		scanner := bufio.NewScanner(f)
+		scanner.Buffer(nil, 1<<20)
+
+		for scanner.Scan() {
+			var rec record
+
+			err = json.Unmarshal(scanner.Bytes(), &rec)
+			if err != nil {
+				// Most likely a line truncated by a crash; skip it.
+				history.expired++
+				continue
+			}
+
+			switch {
+			case rec.Sample != nil:
+				if rec.Sample.Time.Before(cutoff) {
+					history.expired++
+				} else {
+					history.Samples = append(history.Samples, rec.Sample)
+				}
+
+			case rec.Event != nil:
+				if rec.Event.Time.Before(cutoff) {
+					history.expired++
+				} else {
+					history.Events = append(history.Events, rec.Event)
+				}
+
+			case rec.State != nil:
+				history.State = *rec.State
+				history.expired++
+			}
+
+			history.applyEvent(rec.Event)
+		}
+
+		err = scanner.Err()
+		f.Close()
+		if err != nil {
+			return err
+		}
+
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	store.histories[name] = history
+	return store.compact(name, history)
+}
+
+// Updates the last-known state according to an event read back from disk.
+func (history *History) applyEvent(event *Event) {
+	if event == nil {
+		return
+	}
+
+	state := &history.State
+
+	switch event.Type {
+	case EventUp:
+		state.Up = true
+	case EventDown:
+		state.Up = false
+	case EventJoin:
+		state.Players = insertString(state.Players, event.Subject)
+	case EventLeave:
+		state.Players = removeString(state.Players, event.Subject)
+	case EventPluginAdded:
+		state.Plugins = insertString(state.Plugins, event.Subject)
+	case EventPluginRemoved:
+		state.Plugins = removeString(state.Plugins, event.Subject)
+	}
+}
+
+// Rewrites a server's history file so that it contains only the retained samples and
+// events, preceded by a snapshot of the state they were derived from. The store must be
+// locked.
+func (store *Store) compact(name string, history *History) (err error) {
+	if history.file != nil {
+		history.file.Close()
+		history.file = nil
+	}
+
+	filename := store.filename(name)
+	tmpFilename := filename + ".tmp"
+
+	f, err := os.Create(tmpFilename)
+	if err != nil {
+		return err
+	}
+
+	w := bufio.NewWriter(f)
+	enc := json.NewEncoder(w)
+
+	// The snapshot must describe the state before the retained events are replayed, so
+	// undo them in reverse order.
+	initial := history.State
+	initial.Players = append([]string(nil), initial.Players...)
+	initial.Plugins = append([]string(nil), initial.Plugins...)
+
+	for i := len(history.Events) - 1; i >= 0; i-- {
+		event := history.Events[i]
+
+		switch event.Type {
+		case EventJoin:
+			initial.Players = removeString(initial.Players, event.Subject)
+		case EventLeave:
+			initial.Players = insertString(initial.Players, event.Subject)
+		case EventPluginAdded:
+			initial.Plugins = removeString(initial.Plugins, event.Subject)
+		case EventPluginRemoved:
+			initial.Plugins = insertString(initial.Plugins, event.Subject)
+		case EventUp:
+			initial.Up = false
+		case EventDown:
+			initial.Up = true
+		}
+	}
+
+	err = enc.Encode(record{State: &initial})
+
+	for _, sample := range history.Samples {
+		if err != nil {
+			break
+		}
+
+		err = enc.Encode(record{Sample: sample})
+	}
+
+	for _, event := range history.Events {
+		if err != nil {
+			break
+		}
+
+		err = enc.Encode(record{Event: event})
+	}
+
+	if err == nil {
+		err = w.Flush()
+	}
+
+	if err == nil {
+		err = f.Close()
+	} else {
+		f.Close()
+	}
+
+	if err != nil {
+		os.Remove(tmpFilename)
+		return err
+	}
+
+	err = os.Rename(tmpFilename, filename)
+	if err != nil {
+		return err
+	}
+
+	history.file, err = os.OpenFile(filename, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+
+	history.expired = 0
+	return nil
+}
+
+// Adds a sample to a server's history. players and plugins are only consulted if the
+// sample's query succeeded. The events generated by comparing the sample against the
+// previous state are returned.
+func (store *Store) Record(name string, sample *Sample, players []string, plugins []string) (events []*Event, err error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	history := store.histories[name]
+	state := &history.State
+
+	newEvent := func(t string, subject string) {
+		events = append(events, &Event{Time: sample.Time, Type: t, Subject: subject})
+	}
+
+	if state.UpKnown && sample.Up != state.Up {
+		if sample.Up {
+			newEvent(EventUp, "")
+		} else {
+			newEvent(EventDown, "")
+		}
+	}
+
+	if sample.QueryOK {
+		players = sortedCopy(players)
+		plugins = sortedCopy(plugins)
+
+		if state.Known {
+			added, removed := diffStrings(state.Players, players)
+			for _, player := range added {
+				newEvent(EventJoin, player)
+			}
+			for _, player := range removed {
+				newEvent(EventLeave, player)
+			}
+
+			added, removed = diffStrings(state.Plugins, plugins)
+			for _, plugin := range added {
+				newEvent(EventPluginAdded, plugin)
+			}
+			for _, plugin := range removed {
+				newEvent(EventPluginRemoved, plugin)
+			}
+		}
+
+		state.Players = players
+		state.Plugins = plugins
+	}
+
+	// Events only describe changes, so the first observations are recorded as a state
+	// snapshot instead.
+	snapshot := !state.UpKnown || (sample.QueryOK && !state.Known)
+	state.Up = sample.Up
+	state.UpKnown = true
+	state.Known = state.Known || sample.QueryOK
+
+	w := bufio.NewWriter(history.file)
+	enc := json.NewEncoder(w)
+
+	if snapshot {
+		err = enc.Encode(record{State: state})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = enc.Encode(record{Sample: sample})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, event := range events {
+		err = enc.Encode(record{Event: event})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = w.Flush()
+	if err != nil {
+		return nil, err
+	}
+
+	history.Samples = append(history.Samples, sample)
+	history.Events = append(history.Events, events...)
+	store.expire(history)
+
+	// Rewrite the file once most of it is made up of expired records.
+	if history.expired > len(history.Samples)+len(history.Events) {
+		err = store.compact(name, history)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return events, nil
+}
+
+// Drops samples and events older than the retention period from memory. The store must
+// be locked.
+func (store *Store) expire(history *History) {
+	cutoff := time.Now().Add(-store.Retention)
+
+	i := 0
+	for i < len(history.Samples) && history.Samples[i].Time.Before(cutoff) {
+		i++
+	}
+
+	history.Samples = history.Samples[i:]
+	history.expired += i
+
+	i = 0
+	for i < len(history.Events) && history.Events[i].Time.Before(cutoff) {
+		i++
+	}
+
+	history.Events = history.Events[i:]
+	history.expired += i
+}
+
+// Returns a copy of a server's history containing only samples and events at or after
+// since.
+func (store *Store) Get(name string, since time.Time) (result *History, ok bool) {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+
+	history, ok := store.histories[name]
+	if !ok {
+		return nil, false
+	}
+
+	result = &History{State: history.State}
+	result.State.Players = append([]string(nil), history.State.Players...)
+	result.State.Plugins = append([]string(nil), history.State.Plugins...)
+
+	for _, sample := range history.Samples {
+		if !sample.Time.Before(since) {
+			result.Samples = append(result.Samples, sample)
+		}
+	}
+
+	for _, event := range history.Events {
+		if !event.Time.Before(since) {
+			result.Events = append(result.Events, event)
+		}
+	}
+
+	return result, true
+}
+
+// Returns the most recent sample of a server, if any.
+func (store *Store) Latest(name string) (sample *Sample, ok bool) {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+
+	history, ok := store.histories[name]
+	if !ok || len(history.Samples) == 0 {
+		return nil, false
+	}
+
+	return history.Samples[len(history.Samples)-1], true
+}
+
+func (store *Store) Close() (err error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	for _, history := range store.histories {
+		if history.file != nil {
+			e := history.file.Close()
+			if e != nil && err == nil {
+				err = e
+			}
+
+			history.file = nil
+		}
+	}
+
+	return err
+}
+
+func sortedCopy(list []string) (result []string) {
+	result = append([]string(nil), list...)
+	sort.Strings(result)
+	return result
+}
+
+// Compares two sorted lists, returning the strings only in b and the strings only in a.
+func diffStrings(a []string, b []string) (added []string, removed []string) {
+	i, j := 0, 0
+
+	for i < len(a) || j < len(b) {
+		switch {
+		case j >= len(b) || (i < len(a) && a[i] < b[j]):
+			removed = append(removed, a[i])
+			i++
+		case i >= len(a) || b[j] < a[i]:
+			added = append(added, b[j])
+			j++
+		default:
+			i++
+			j++
+		}
+	}
+
+	return added, removed
+}
+
+// Inserts s into a sorted list if it is not already present.
+func insertString(list []string, s string) (result []string) {
+	i := sort.SearchStrings(list, s)
+	if i < len(list) && list[i] == s {
+		return list
+	}
+
+	list = append(list, "")
+	copy(list[i+1:], list[i:])
+	list[i] = s
+	return list
+}
+
+// Removes s from a sorted list if it is present.
+func removeString(list []string, s string) (result []string) {
+	i := sort.SearchStrings(list, s)
+	if i < len(list) && list[i] == s {
+		return append(list[:i], list[i+1:]...)
+	}
+
+	return list
+}
@@ -0,0 +1,217 @@
+package mcquery
+
+import (
+	"context"
+	"net"
+	"sync"
+	"time"
+)
+
+// A reusable connection to a server's query port. The challenge token obtained by the
+// handshake is cached and renewed when it is older than ChallengeLifetime, or when the
+// server stops answering requests made with it. A Client may be used from several
+// goroutines; requests are serialised.
+type Client struct {
+	Timeout           time.Duration // How long to wait for each reply.
+	MaxRetries        int           // How many times a request is sent before giving up.
+	ChallengeLifetime time.Duration // How long a challenge token is reused before a new handshake.
+
+	mutex      sync.Mutex
+	conn       net.Conn
+	id         uint32
+	challenge  uint32
+	challenged time.Time
+}
+
+// Opens a query connection to addr. No packets are sent until the first request.
+func Dial(addr string) (c *Client, err error) {
+	return DialContext(context.Background(), addr)
+}
+
+func DialContext(ctx context.Context, addr string) (c *Client, err error) {
+	var dialer net.Dialer
+
+	conn, err := dialer.DialContext(ctx, "udp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Client{
+		Timeout:           Timeout,
+		MaxRetries:        MaxRetries,
+		ChallengeLifetime: ChallengeLifetime,
+		conn:              conn,
+	}, nil
+}
+
+func (c *Client) Close() (err error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return c.conn.Close()
+}
+
+// Obtains a new challenge token from the server.
+func (c *Client) Handshake(ctx context.Context) (err error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return c.handshake(ctx)
+}
+
+func (c *Client) handshake(ctx context.Context) (err error) {
+	c.id++
+
+	payload, err := c.roundTrip(ctx, 9, nil)
+	if err != nil {
+		return err
+	}
+
+	challenge, err := ParseHandshake(payload)
+	if err != nil {
+		return err
+	}
+
+	c.challenge = challenge
+	c.challenged = time.Now()
+	return nil
+}
+
+func (c *Client) BasicStat() (r *Stat, err error) {
+	return c.BasicStatContext(context.Background())
+}
+
+func (c *Client) FullStat() (r *Stat, err error) {
+	return c.FullStatContext(context.Background())
+}
+
+func (c *Client) BasicStatContext(ctx context.Context) (r *Stat, err error) {
+	payload, err := c.stat(ctx, false)
+	if err != nil {
+		return nil, err
+	}
+
+	return ParseBasicStat(payload)
+}
+
+func (c *Client) FullStatContext(ctx context.Context) (r *Stat, err error) {
+	payload, err := c.stat(ctx, true)
+	if err != nil {
+		return nil, err
+	}
+
+	return ParseFullStat(payload)
+}
+
+// Sends a stat request, first performing a handshake if the cached challenge is missing
+// or stale. Servers silently drop requests carrying an expired token, so if a request made
+// with a cached token goes unanswered, it is retried once with a fresh one.
+func (c *Client) stat(ctx context.Context, full bool) (payload []byte, err error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	fresh := false
+
+	if c.challenged.IsZero() || time.Since(c.challenged) > c.ChallengeLifetime {
+		err = c.handshake(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		fresh = true
+	}
+
+	payload, err = c.roundTrip(ctx, 0, statRequest(c.challenge, full))
+	if err == ErrNoResponse && !fresh {
+		err = c.handshake(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		payload, err = c.roundTrip(ctx, 0, statRequest(c.challenge, full))
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return payload, nil
+}
+
+// Sends a request and waits for the matching reply, resending it up to MaxRetries times
+// in total. Replies with the wrong type or session ID (such as late replies to an earlier
+// request) are discarded. The client must be locked.
+func (c *Client) roundTrip(ctx context.Context, t byte, payload []byte) (reply []byte, err error) {
+	message := make([]byte, len(payload)+7)
+	message[0] = 0xFE
+	message[1] = 0xFD
+	message[2] = t
+	putUint32(message[3:7], c.id)
+	copy(message[7:], payload)
+
+	// Unblock a pending read if the context is cancelled.
+	stop := make(chan struct{})
+	defer close(stop)
+
+	go func() {
+		select {
+		case <-ctx.Done():
+			c.conn.SetReadDeadline(time.Now())
+		case <-stop:
+		}
+	}()
+
+	buffer := make([]byte, 65536)
+
+	for attempt := 0; attempt < c.MaxRetries; attempt++ {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+
+		_, err = c.conn.Write(message)
+		if err != nil {
+			return nil, err
+		}
+
+		deadline := time.Now().Add(c.Timeout)
+		ctxDeadline, ok := ctx.Deadline()
+		if ok && ctxDeadline.Before(deadline) {
+			deadline = ctxDeadline
+		}
+
+		err = c.conn.SetReadDeadline(deadline)
+		if err != nil {
+			return nil, err
+		}
+
+		for {
+			n, err := c.conn.Read(buffer)
+			if err != nil {
+				if ctx.Err() != nil {
+					return nil, ctx.Err()
+				}
+
+				e, ok := err.(net.Error)
+				if ok && e.Timeout() {
+					break
+				}
+
+				return nil, err
+			}
+
+			if n >= 5 && buffer[0] == t && matchID(getUint32(buffer[1:5]), c.id) {
+				reply = make([]byte, n-5)
+				copy(reply, buffer[5:n])
+				return reply, nil
+			}
+		}
+	}
+
+	return nil, ErrNoResponse
+}
+
+// Reports whether a reply's session ID matches the request's. Vanilla servers only echo
+// the bits of the session ID covered by 0x0F0F0F0F.
+func matchID(replyID uint32, id uint32) (ok bool) {
+	return replyID == id || replyID == id&0x0F0F0F0F
+}
@@ -1,18 +1,27 @@
 package mcquery
 
 import (
-	"bytes"
-	"fmt"
+	"context"
+	"errors"
 	"net"
-	"sort"
-	"strconv"
 	"strings"
 	"time"
 )
 
+// The default number of times a request is sent before giving up.
 const MaxRetries = 3
+
+// The default time to wait for each reply.
 const Timeout = time.Second * 5
 
+// The default time a challenge token is reused for. Servers rotate their tokens every 30
+// seconds.
+const ChallengeLifetime = time.Second * 25
+
+// Returned when a server does not reply to any of the attempts at a request.
+var ErrNoResponse = errors.New("Retry limit reached - server down?")
+
+// Deprecated: use Client.
 type Connection struct {
 	Conn      net.Conn
 	ID        uint32
@@ -21,18 +30,19 @@ type Connection struct {
 }
 
 type Stat struct {
-	MOTD       string
-	GameType   string
-	GameID     string
-	Version    string
-	ServerMod  string
-	Map        string
-	NumPlayers int
-	MaxPlayers int
-	HostPort   int
-	HostName   string
-	Plugins    []string
-	Players    []string
+	MOTD       string            `json:"motd"`
+	GameType   string            `json:"game_type"`
+	GameID     string            `json:"game_id"`
+	Version    string            `json:"version"`
+	ServerMod  string            `json:"server_mod"`
+	Map        string            `json:"map"`
+	NumPlayers int               `json:"num_players"`
+	MaxPlayers int               `json:"max_players"`
+	HostPort   int               `json:"host_port"`
+	HostName   string            `json:"host_ip"`
+	Plugins    []string          `json:"plugins"`
+	Players    []string          `json:"players"`
+	Extra      map[string]string `json:"extra,omitempty"` // Full stat key/value pairs not covered by the fields above.
 }
 
 func getUint32(b []byte) (n uint32) {
@@ -50,6 +60,7 @@ func putUint32(b []byte, n uint32) {
 	b[3] = byte(n)
 }
 
+// Deprecated: use Dial.
 func Connect(addr string) (c *Connection, err error) {
 	conn, err := net.Dial("udp", addr)
 	if err != nil {
@@ -95,6 +106,10 @@ func (c *Connection) ReadPacket() (t byte, id uint32, payload []byte, err error)
 		return 0, 0, nil, err
 	}
 
+	if n < 5 {
+		return 0, 0, nil, &ParseError{Packet: "reply", Offset: n, Err: ErrTruncated}
+	}
+
 	buffer = buffer[:n]
 
 	t = buffer[0]
@@ -104,198 +119,129 @@ func (c *Connection) ReadPacket() (t byte, id uint32, payload []byte, err error)
 	return t, id, payload, nil
 }
 
+// Deprecated: Connection retries with fixed settings and has no way to cancel a request.
+// Use Client instead.
 func (c *Connection) Handshake() (err error) {
-	c.ID += 1
-	err = c.WritePacket(9, nil)
-	if err != nil {
-		return err
-	}
+	for {
+		c.ID += 1
+		err = c.WritePacket(9, nil)
+		if err != nil {
+			return err
+		}
 
-	_, _, payload, err := c.ReadPacket()
-	if err != nil {
-		e, ok := err.(net.Error)
-		if ok && e.Timeout() {
-			c.Retries++
+		_, _, payload, err := c.ReadPacket()
+		if err != nil {
+			e, ok := err.(net.Error)
+			if ok && e.Timeout() {
+				c.Retries++
 
-			if c.Retries == MaxRetries {
-				return fmt.Errorf("Retry limit reached - server down?")
+				if c.Retries >= MaxRetries {
+					c.Retries = 0
+					return ErrNoResponse
+				}
+
+				continue
 			}
 
-			return c.Handshake()
+			return err
 		}
 
-		return err
-	}
-
-	challenge, err := strconv.ParseUint(string(payload[:len(payload)-1]), 10, 32)
-	if err != nil {
-		return err
-	}
+		challenge, err := ParseHandshake(payload)
+		if err != nil {
+			return err
+		}
 
-	c.Retries = 0
-	c.Challenge = uint32(challenge)
+		c.Retries = 0
+		c.Challenge = challenge
 
-	return nil
+		return nil
+	}
 }
 
-func (c *Connection) BasicStat() (r *Stat, err error) {
-	packet := make([]byte, 4)
-	putUint32(packet, c.Challenge)
-
-	err = c.WritePacket(0, packet)
-	if err != nil {
-		return nil, err
-	}
+// Sends a stat request, performing a new handshake and trying once more if the server
+// does not reply (which is what happens when the challenge token has expired).
+func (c *Connection) stat(full bool) (payload []byte, err error) {
+	packet := statRequest(c.Challenge, full)
 
-	_, _, payload, err := c.ReadPacket()
-	if err != nil {
-		err = c.Handshake()
+	for attempt := 0; ; attempt++ {
+		err = c.WritePacket(0, packet)
 		if err != nil {
 			return nil, err
 		}
 
-		return c.BasicStat()
-	}
-
-	r = new(Stat)
-	parts := bytes.SplitN(payload, []byte{0}, 6)
+		_, _, payload, err = c.ReadPacket()
+		if err == nil || attempt > 0 {
+			return payload, err
+		}
 
-	r.MOTD = string(parts[0])
-	r.GameType = string(parts[1])
-	r.Map = string(parts[2])
+		err = c.Handshake()
+		if err != nil {
+			return nil, err
+		}
 
-	numPlayers, err := strconv.ParseInt(string(parts[3]), 10, 0)
-	if err != nil {
-		return nil, err
+		putUint32(packet, c.Challenge)
 	}
+}
 
-	maxPlayers, err := strconv.ParseInt(string(parts[4]), 10, 0)
+func (c *Connection) BasicStat() (r *Stat, err error) {
+	payload, err := c.stat(false)
 	if err != nil {
 		return nil, err
 	}
 
-	r.NumPlayers = int(numPlayers)
-	r.MaxPlayers = int(maxPlayers)
-
-	payload = parts[5]
-	r.HostPort = int(uint16(payload[0]) | (uint16(payload[1]) << 8))
-	r.HostName = string(payload[2 : len(payload)-1])
-
-	return r, nil
+	return ParseBasicStat(payload)
 }
 
 func (c *Connection) FullStat() (r *Stat, err error) {
-	packet := make([]byte, 8)
-	putUint32(packet, c.Challenge)
-
-	err = c.WritePacket(0, packet)
+	payload, err := c.stat(true)
 	if err != nil {
 		return nil, err
 	}
 
-	_, _, payload, err := c.ReadPacket()
-	if err != nil {
-		err = c.Handshake()
-		if err != nil {
-			return nil, err
-		}
-
-		return c.FullStat()
-	}
-
-	payload = payload[11:]
-	p := bytes.Index(payload, []byte("\x00\x00\x01player_\x00\x00"))
-	itemsPayload := payload[:p]
-	playersPayload := payload[p+12:]
-
-	r = new(Stat)
-
-	itemsParts := bytes.Split(itemsPayload, []byte{0x00})
-	for i := 0; i < len(itemsParts); i += 2 {
-		key := string(itemsParts[i])
-		value := string(itemsParts[i+1])
-
-		switch key {
-		case "hostname":
-			r.MOTD = value
-		case "gametype":
-			r.GameType = value
-		case "game_id":
-			r.GameID = value
-		case "version":
-			r.Version = value
-		case "plugins":
-			r.ServerMod, r.Plugins = parsePlugins(value)
-		case "map":
-			r.Map = value
-
-		case "numplayers":
-			v, err := strconv.ParseInt(value, 10, 0)
-			if err != nil {
-				return nil, err
-			}
-
-			r.NumPlayers = int(v)
-
-		case "maxplayers":
-			v, err := strconv.ParseInt(value, 10, 0)
-			if err != nil {
-				return nil, err
-			}
-
-			r.MaxPlayers = int(v)
-
-		case "hostport":
-			v, err := strconv.ParseInt(value, 10, 0)
-			if err != nil {
-				return nil, err
-			}
-
-			r.HostPort = int(v)
-
-		case "hostip":
-			r.HostName = value
-		}
-	}
+	return ParseFullStat(payload)
+}
 
-	if len(playersPayload) > 2 {
-		playersPayload = playersPayload[:len(playersPayload)-2]
-		r.Players = strings.Split(string(playersPayload), "\x00")
+// Builds the payload of a stat request. A full stat is requested by padding the challenge
+// token with four bytes.
+func statRequest(challenge uint32, full bool) (packet []byte) {
+	if full {
+		packet = make([]byte, 8)
+	} else {
+		packet = make([]byte, 4)
 	}
 
-	sort.Sort(caseInsensitiveStrings(r.Plugins))
-	sort.Sort(caseInsensitiveStrings(r.Players))
-
-	return r, nil
+	putUint32(packet, challenge)
+	return packet
 }
 
+// Queries the server at addr once, using a new Client.
 func BasicStat(addr string) (r *Stat, err error) {
-	conn, err := Connect(addr)
-	if err != nil {
-		return nil, err
-	}
-
-	return conn.BasicStat()
+	return BasicStatContext(context.Background(), addr)
 }
 
+// Queries the server at addr once, using a new Client.
 func FullStat(addr string) (r *Stat, err error) {
-	conn, err := Connect(addr)
+	return FullStatContext(context.Background(), addr)
+}
+
+func BasicStatContext(ctx context.Context, addr string) (r *Stat, err error) {
+	c, err := DialContext(ctx, addr)
 	if err != nil {
 		return nil, err
 	}
 
-	return conn.FullStat()
+	defer c.Close()
+	return c.BasicStatContext(ctx)
 }
 
-func parsePlugins(s string) (serverMod string, plugins []string) {
-	p := strings.Index(s, ": ")
-	if p < 0 {
-		return s, nil
+func FullStatContext(ctx context.Context, addr string) (r *Stat, err error) {
+	c, err := DialContext(ctx, addr)
+	if err != nil {
+		return nil, err
 	}
 
-	serverMod = s[:p]
-	plugins = strings.Split(s[p+2:], "; ")
-	return serverMod, plugins
+	defer c.Close()
+	return c.FullStatContext(ctx)
 }
 
 type caseInsensitiveStrings []string
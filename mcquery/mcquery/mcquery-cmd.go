@@ -1,39 +1,191 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
 	"github.com/kierdavis/mc/mcquery"
 	"os"
 	"strings"
+	"sync"
+	"time"
 )
 
+// Exit codes. When several targets fail in different ways, the highest applies.
+const (
+	ExitOK          = 0
+	ExitUnreachable = 1 // A server did not answer, or could not be contacted.
+	ExitUsage       = 2
+	ExitMalformed   = 3 // A server answered with a reply that could not be parsed.
+)
+
+var (
+	jsonP    = flag.Bool("json", false, "Print one JSON object per target, one per line, instead of the human-readable layout.")
+	basicP   = flag.Bool("basic", false, "Request a basic stat instead of a full stat. Basic stats omit the game ID, version, plugins and player list.")
+	timeoutP = flag.Duration("timeout", mcquery.Timeout, "How long to wait for each server, including retries.")
+)
+
+// The JSON output for one target. The schema is stable: fields are only ever added.
+type Result struct {
+	Target    string        `json:"target"`
+	OK        bool          `json:"ok"`
+	Error     *ResultError  `json:"error"`
+	LatencyMS float64       `json:"latency_ms"`
+	Basic     bool          `json:"basic"`
+	Stat      *mcquery.Stat `json:"stat"`
+
+	exitCode int
+}
+
+type ResultError struct {
+	Kind    string `json:"kind"` // "unreachable" or "malformed"
+	Message string `json:"message"`
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: %s [options] <host[:port]> ...\n\nOptions:\n", os.Args[0])
+	flag.PrintDefaults()
+	fmt.Fprintf(os.Stderr, "\nExit status is 0 if every server answered, %d if any server was unreachable\nand %d if any server sent a malformed reply.\n", ExitUnreachable, ExitMalformed)
+}
+
 func main() {
-	if len(os.Args) < 2 {
-		fmt.Fprintf(os.Stderr, "Usage: %s <host[:port]>\n", os.Args[0])
-		os.Exit(2)
+	flag.Usage = usage
+	flag.Parse()
+
+	if flag.NArg() < 1 {
+		usage()
+		os.Exit(ExitUsage)
+	}
+
+	results := make([]*Result, flag.NArg())
+
+	var wg sync.WaitGroup
+
+	for i, addr := range flag.Args() {
+		if strings.Index(addr, ":") < 0 {
+			addr += ":25565"
+		}
+
+		wg.Add(1)
+
+		go func(i int, addr string) {
+			defer wg.Done()
+			results[i] = query(addr, *basicP, *timeoutP)
+		}(i, addr)
 	}
 
-	addr := os.Args[1]
+	wg.Wait()
+
+	exitCode := ExitOK
+
+	for i, result := range results {
+		if *jsonP {
+			data, err := json.Marshal(result)
+			if err != nil {
+				panic(err)
+			}
 
-	if strings.Index(addr, ":") < 0 {
-		addr += ":25565"
+			fmt.Printf("%s\n", data)
+
+		} else {
+			if len(results) > 1 {
+				if i > 0 {
+					fmt.Printf("\n")
+				}
+
+				fmt.Printf("== %s ==\n", result.Target)
+			}
+
+			printResult(result)
+		}
+
+		if result.exitCode > exitCode {
+			exitCode = result.exitCode
+		}
+	}
+
+	os.Exit(exitCode)
+}
+
+// Queries a single server, classifying any failure.
+func query(addr string, basic bool, timeout time.Duration) (result *Result) {
+	result = &Result{Target: addr, Basic: basic}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	start := time.Now()
+
+	client, err := mcquery.DialContext(ctx, addr)
+	if err == nil {
+		defer client.Close()
+
+		// Leave time for every retry within the overall timeout.
+		client.Timeout = timeout / time.Duration(client.MaxRetries)
+
+		if basic {
+			result.Stat, err = client.BasicStatContext(ctx)
+		} else {
+			result.Stat, err = client.FullStatContext(ctx)
+		}
 	}
 
-	st, err := mcquery.FullStat(addr)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error: %s\n", err.Error())
-		os.Exit(1)
+		result.Error = &ResultError{Kind: "unreachable", Message: err.Error()}
+		result.exitCode = ExitUnreachable
+
+		var parseErr *mcquery.ParseError
+		if errors.As(err, &parseErr) {
+			result.Error.Kind = "malformed"
+			result.exitCode = ExitMalformed
+		}
+
+		return result
+	}
+
+	result.OK = true
+	result.LatencyMS = float64(time.Since(start)) / float64(time.Millisecond)
+
+	// Keep the schema free of nulls where a list is expected.
+	if result.Stat.Plugins == nil {
+		result.Stat.Plugins = []string{}
 	}
 
+	if result.Stat.Players == nil {
+		result.Stat.Players = []string{}
+	}
+
+	return result
+}
+
+func printResult(result *Result) {
+	if !result.OK {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", result.Error.Message)
+		return
+	}
+
+	st := result.Stat
+
 	fmt.Printf("MOTD: %s\n", st.MOTD)
 	fmt.Printf("Game Type: %s\n", st.GameType)
-	fmt.Printf("Game ID: %s\n", st.GameID)
-	fmt.Printf("Version: %s\n", st.Version)
-	fmt.Printf("Server Mod: %s\n", st.ServerMod)
+
+	if !result.Basic {
+		fmt.Printf("Game ID: %s\n", st.GameID)
+		fmt.Printf("Version: %s\n", st.Version)
+		fmt.Printf("Server Mod: %s\n", st.ServerMod)
+	}
+
 	fmt.Printf("Map: %s\n", st.Map)
 	fmt.Printf("Players: %d/%d\n", st.NumPlayers, st.MaxPlayers)
 	fmt.Printf("IP: %s\n", st.HostName)
 	fmt.Printf("Port: %d\n", st.HostPort)
+
+	if result.Basic {
+		return
+	}
+
 	fmt.Printf("\nPlugins:\n")
 
 	for _, plugin := range st.Plugins {
@@ -0,0 +1,280 @@
+package mcquery
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrTruncated = errors.New("reply is truncated")
+	ErrMalformed = errors.New("reply is malformed")
+)
+
+// Returned when a reply from a server cannot be parsed.
+type ParseError struct {
+	Packet string // The kind of reply: "handshake", "basic stat", "full stat" or "reply".
+	Field  string // The field being parsed, if known.
+	Offset int    // The offset into the payload at which the problem was found.
+	Err    error  // ErrTruncated, ErrMalformed or the error from parsing a number.
+}
+
+func (e *ParseError) Error() (s string) {
+	if e.Field != "" {
+		return fmt.Sprintf("mcquery: bad %s reply: %s at offset %d: %s", e.Packet, e.Field, e.Offset, e.Err.Error())
+	}
+
+	return fmt.Sprintf("mcquery: bad %s reply at offset %d: %s", e.Packet, e.Offset, e.Err.Error())
+}
+
+func (e *ParseError) Unwrap() (err error) {
+	return e.Err
+}
+
+// Reads NUL-terminated strings from a payload.
+type payloadReader struct {
+	packet  string
+	payload []byte
+	pos     int
+}
+
+func (r *payloadReader) fail(field string, err error) (e *ParseError) {
+	return &ParseError{Packet: r.packet, Field: field, Offset: r.pos, Err: err}
+}
+
+func (r *payloadReader) atEnd() (ok bool) {
+	return r.pos >= len(r.payload)
+}
+
+func (r *payloadReader) readString(field string) (s string, err error) {
+	p := bytes.IndexByte(r.payload[r.pos:], 0)
+	if p < 0 {
+		return "", r.fail(field, ErrTruncated)
+	}
+
+	s = string(r.payload[r.pos : r.pos+p])
+	r.pos += p + 1
+	return s, nil
+}
+
+func (r *payloadReader) readInt(field string) (n int, err error) {
+	start := r.pos
+
+	s, err := r.readString(field)
+	if err != nil {
+		return 0, err
+	}
+
+	v, err := strconv.ParseInt(s, 10, 32)
+	if err != nil {
+		r.pos = start
+		return 0, r.fail(field, err)
+	}
+
+	return int(v), nil
+}
+
+func (r *payloadReader) expect(field string, prefix string) (err error) {
+	rest := r.payload[r.pos:]
+
+	if len(rest) < len(prefix) {
+		if bytes.HasPrefix([]byte(prefix), rest) {
+			return r.fail(field, ErrTruncated)
+		}
+
+		return r.fail(field, ErrMalformed)
+	}
+
+	if string(rest[:len(prefix)]) != prefix {
+		return r.fail(field, ErrMalformed)
+	}
+
+	r.pos += len(prefix)
+	return nil
+}
+
+// Parses the payload of a handshake reply: the challenge token as a NUL-terminated decimal
+// string. Servers send the token as a signed 32-bit number.
+func ParseHandshake(payload []byte) (challenge uint32, err error) {
+	r := &payloadReader{packet: "handshake", payload: payload}
+
+	s, err := r.readString("challenge token")
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || n < -1<<31 || n >= 1<<32 {
+		if err == nil {
+			err = ErrMalformed
+		}
+
+		return 0, &ParseError{Packet: "handshake", Field: "challenge token", Offset: 0, Err: err}
+	}
+
+	return uint32(n), nil
+}
+
+// Parses the payload of a basic stat reply: the MOTD, game type, map, player counts, a
+// little-endian host port and the host IP.
+func ParseBasicStat(payload []byte) (r *Stat, err error) {
+	pr := &payloadReader{packet: "basic stat", payload: payload}
+	r = new(Stat)
+
+	r.MOTD, err = pr.readString("motd")
+	if err != nil {
+		return nil, err
+	}
+
+	r.GameType, err = pr.readString("gametype")
+	if err != nil {
+		return nil, err
+	}
+
+	r.Map, err = pr.readString("map")
+	if err != nil {
+		return nil, err
+	}
+
+	r.NumPlayers, err = pr.readInt("numplayers")
+	if err != nil {
+		return nil, err
+	}
+
+	r.MaxPlayers, err = pr.readInt("maxplayers")
+	if err != nil {
+		return nil, err
+	}
+
+	if len(payload)-pr.pos < 2 {
+		return nil, pr.fail("hostport", ErrTruncated)
+	}
+
+	r.HostPort = int(uint16(payload[pr.pos]) | (uint16(payload[pr.pos+1]) << 8))
+	pr.pos += 2
+
+	r.HostName, err = pr.readString("hostip")
+	if err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// The padding at the start of a full stat payload.
+const fullStatPaddingLen = 11
+
+// Marks the end of the key/value section of a full stat payload.
+const fullStatPlayersMarker = "\x01player_\x00\x00"
+
+// Parses the payload of a full stat reply: 11 bytes of padding, NUL-terminated key/value
+// pairs ending with an empty key, then the player section. Keys that do not correspond
+// to a field of Stat are kept in Extra.
+func ParseFullStat(payload []byte) (r *Stat, err error) {
+	pr := &payloadReader{packet: "full stat", payload: payload}
+
+	if len(payload) < fullStatPaddingLen {
+		return nil, pr.fail("padding", ErrTruncated)
+	}
+
+	pr.pos = fullStatPaddingLen
+	r = new(Stat)
+
+	for {
+		key, err := pr.readString("key")
+		if err != nil {
+			return nil, err
+		}
+
+		if key == "" {
+			break
+		}
+
+		valueStart := pr.pos
+
+		value, err := pr.readString(key)
+		if err != nil {
+			return nil, err
+		}
+
+		switch key {
+		case "hostname":
+			r.MOTD = value
+		case "gametype":
+			r.GameType = value
+		case "game_id":
+			r.GameID = value
+		case "version":
+			r.Version = value
+		case "plugins":
+			r.ServerMod, r.Plugins = parsePlugins(value)
+		case "map":
+			r.Map = value
+		case "hostip":
+			r.HostName = value
+
+		case "numplayers", "maxplayers", "hostport":
+			v, err := strconv.ParseInt(value, 10, 32)
+			if err != nil {
+				return nil, &ParseError{Packet: "full stat", Field: key, Offset: valueStart, Err: err}
+			}
+
+			switch key {
+			case "numplayers":
+				r.NumPlayers = int(v)
+			case "maxplayers":
+				r.MaxPlayers = int(v)
+			case "hostport":
+				r.HostPort = int(v)
+			}
+
+		default:
+			if r.Extra == nil {
+				r.Extra = make(map[string]string)
+			}
+
+			r.Extra[key] = value
+		}
+	}
+
+	// Some servers omit the player section entirely when nobody is online.
+	if !pr.atEnd() {
+		err = pr.expect("player section", fullStatPlayersMarker)
+		if err != nil {
+			return nil, err
+		}
+
+		for !pr.atEnd() {
+			name, err := pr.readString("player")
+			if err != nil {
+				return nil, err
+			}
+
+			if name == "" {
+				break
+			}
+
+			r.Players = append(r.Players, name)
+		}
+	}
+
+	sort.Sort(caseInsensitiveStrings(r.Plugins))
+	sort.Sort(caseInsensitiveStrings(r.Players))
+
+	return r, nil
+}
+
+// Splits the value of the "plugins" key, which has the form "<server mod>: <plugin>; ...".
+func parsePlugins(s string) (serverMod string, plugins []string) {
+	p := strings.Index(s, ": ")
+	if p < 0 {
+		return s, nil
+	}
+
+	serverMod = s[:p]
+	plugins = strings.Split(s[p+2:], "; ")
+	return serverMod, plugins
+}
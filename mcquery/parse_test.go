@@ -0,0 +1,145 @@
+package mcquery
+
+import (
+	"errors"
+	"strconv"
+	"testing"
+)
+
+// Payloads of replies captured from servers, after the type and session ID.
+var (
+	capturedHandshakes = []string{
+		"9513307\x00",
+		"-1246826402\x00",
+	}
+
+	capturedBasicStats = []string{
+		// Vanilla 1.2.5.
+		"A Minecraft Server\x00SMP\x00world\x002\x0020\x00\xdd\x63127.0.0.1\x00",
+		// CraftBukkit, with colour escapes in the MOTD.
+		"\xa7aSurvival \xa7fserver\x00SMP\x00survival\x000\x0040\x00\xde\x630.0.0.0\x00",
+	}
+
+	capturedFullStats = []string{
+		// Vanilla 1.2.5, with two players online.
+		"splitnum\x00\x80\x00" +
+			"hostname\x00A Minecraft Server\x00gametype\x00SMP\x00game_id\x00MINECRAFT\x00" +
+			"version\x001.2.5\x00plugins\x00\x00map\x00world\x00numplayers\x002\x00maxplayers\x0020\x00" +
+			"hostport\x0025565\x00hostip\x00127.0.0.1\x00\x00" +
+			"\x01player_\x00\x00barneygale\x00Vivalahelvig\x00\x00",
+		// CraftBukkit with plugins and nobody online.
+		"splitnum\x00\x80\x00" +
+			"hostname\x00Bukkit Server\x00gametype\x00SMP\x00game_id\x00MINECRAFT\x00" +
+			"version\x001.3.2\x00plugins\x00CraftBukkit on Bukkit 1.3.2-R1.0: WorldEdit 5.4.2; Essentials 2.9.2\x00" +
+			"map\x00world\x00numplayers\x000\x00maxplayers\x0032\x00hostport\x0025565\x00hostip\x000.0.0.0\x00\x00" +
+			"\x01player_\x00\x00\x00",
+	}
+)
+
+// Checks that a parse error is a *ParseError wrapping one of the package's errors or a
+// number parsing error.
+func checkParseError(t *testing.T, err error) {
+	var pe *ParseError
+	if !errors.As(err, &pe) {
+		t.Fatalf("Error is not a *ParseError: %#v", err)
+	}
+
+	var ne *strconv.NumError
+	if !errors.Is(err, ErrTruncated) && !errors.Is(err, ErrMalformed) && !errors.As(err, &ne) {
+		t.Fatalf("Unexpected error cause: %s", err.Error())
+	}
+
+	_ = err.Error()
+}
+
+func TestParseCaptures(t *testing.T) {
+	challenge, err := ParseHandshake([]byte(capturedHandshakes[0]))
+	if err != nil || challenge != 9513307 {
+		t.Errorf("ParseHandshake: got %d, %v", challenge, err)
+	}
+
+	stat, err := ParseBasicStat([]byte(capturedBasicStats[0]))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if stat.MOTD != "A Minecraft Server" || stat.NumPlayers != 2 || stat.MaxPlayers != 20 || stat.HostPort != 25565 || stat.HostName != "127.0.0.1" {
+		t.Errorf("ParseBasicStat: got %+v", stat)
+	}
+
+	stat, err = ParseFullStat([]byte(capturedFullStats[0]))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if stat.Version != "1.2.5" || len(stat.Players) != 2 || stat.Players[0] != "barneygale" || stat.HostPort != 25565 {
+		t.Errorf("ParseFullStat: got %+v", stat)
+	}
+
+	stat, err = ParseFullStat([]byte(capturedFullStats[1]))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if stat.ServerMod != "CraftBukkit on Bukkit 1.3.2-R1.0" || len(stat.Plugins) != 2 || len(stat.Players) != 0 {
+		t.Errorf("ParseFullStat: got %+v", stat)
+	}
+}
+
+func FuzzParseHandshake(f *testing.F) {
+	for _, payload := range capturedHandshakes {
+		f.Add([]byte(payload))
+	}
+
+	f.Fuzz(func(t *testing.T, payload []byte) {
+		challenge, err := ParseHandshake(payload)
+		if err != nil {
+			checkParseError(t, err)
+			return
+		}
+
+		// The token must survive being sent back as the server sends it.
+		again, err := ParseHandshake([]byte(strconv.Itoa(int(int32(challenge))) + "\x00"))
+		if err != nil || again != challenge {
+			t.Fatalf("Challenge %d did not round trip: got %d, %v", challenge, again, err)
+		}
+	})
+}
+
+func FuzzParseBasicStat(f *testing.F) {
+	for _, payload := range capturedBasicStats {
+		f.Add([]byte(payload))
+	}
+
+	f.Fuzz(func(t *testing.T, payload []byte) {
+		stat, err := ParseBasicStat(payload)
+		if err != nil {
+			checkParseError(t, err)
+			return
+		}
+
+		if stat.HostPort < 0 || stat.HostPort > 0xFFFF {
+			t.Fatalf("Host port out of range: %d", stat.HostPort)
+		}
+	})
+}
+
+func FuzzParseFullStat(f *testing.F) {
+	for _, payload := range capturedFullStats {
+		f.Add([]byte(payload))
+	}
+
+	f.Fuzz(func(t *testing.T, payload []byte) {
+		stat, err := ParseFullStat(payload)
+		if err != nil {
+			checkParseError(t, err)
+			return
+		}
+
+		for _, name := range stat.Players {
+			if name == "" {
+				t.Fatalf("Empty player name in %q", stat.Players)
+			}
+		}
+	})
+}
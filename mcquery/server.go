@@ -0,0 +1,281 @@
+package mcquery
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The time between challenge token rotations used by vanilla servers.
+const ChallengeRotation = time.Second * 30
+
+// Answers query requests on behalf of a server. Each client must obtain a challenge token
+// with a handshake before it may request stats; tokens are tied to the client's address
+// and rotate every Rotation, with the previous token remaining valid for one more period
+// so that clients are not cut off mid-request. Requests without a valid token are dropped
+// without a reply, as vanilla servers do.
+type Server struct {
+	// Called for every stat request to obtain the information to send. Only the fields
+	// relevant to the request are used; basic stats ignore Plugins, Players and Extra.
+	Stat func(addr net.Addr) *Stat
+
+	Rotation time.Duration // How often challenge tokens rotate. Defaults to ChallengeRotation.
+
+	mutex     sync.Mutex
+	conn      net.PacketConn
+	closed    bool
+	secret    [2][8]byte
+	rotatedAt time.Time
+}
+
+// Listens on the UDP address addr and serves requests until the server is closed.
+func (s *Server) ListenAndServe(addr string) (err error) {
+	conn, err := net.ListenPacket("udp", addr)
+	if err != nil {
+		return err
+	}
+
+	return s.Serve(conn)
+}
+
+// Serves requests arriving on conn until the server is closed, then returns nil. The
+// connection is closed on return.
+func (s *Server) Serve(conn net.PacketConn) (err error) {
+	defer conn.Close()
+
+	s.mutex.Lock()
+	closed := s.closed
+	s.conn = conn
+	s.mutex.Unlock()
+
+	if closed {
+		return nil
+	}
+
+	buffer := make([]byte, 1500)
+
+	for {
+		n, addr, err := conn.ReadFrom(buffer)
+		if err != nil {
+			if e, ok := err.(net.Error); ok && e.Timeout() {
+				continue
+			}
+
+			if s.isClosed() {
+				return nil
+			}
+
+			return err
+		}
+
+		reply := s.handle(buffer[:n], addr)
+		if reply != nil {
+			conn.WriteTo(reply, addr)
+		}
+	}
+}
+
+// Stops the server, causing Serve to return. If Serve has not been called yet, it will
+// return as soon as it is.
+func (s *Server) Close() (err error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.closed = true
+
+	if s.conn == nil {
+		return nil
+	}
+
+	return s.conn.Close()
+}
+
+// Reports whether Close has been called.
+func (s *Server) isClosed() (closed bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.closed
+}
+
+// Builds the reply to a request, or returns nil if it should be dropped.
+func (s *Server) handle(request []byte, addr net.Addr) (reply []byte) {
+	if len(request) < 7 || request[0] != 0xFE || request[1] != 0xFD {
+		return nil
+	}
+
+	t := request[2]
+	id := getUint32(request[3:7]) & 0x0F0F0F0F
+	payload := request[7:]
+
+	var body []byte
+
+	switch t {
+	case 9:
+		current, _ := s.tokens(addr)
+		body = []byte(strconv.FormatInt(int64(int32(current)), 10) + "\x00")
+
+	case 0:
+		if len(payload) != 4 && len(payload) != 8 {
+			return nil
+		}
+
+		token := getUint32(payload[:4])
+		current, previous := s.tokens(addr)
+		if token != current && token != previous {
+			return nil
+		}
+
+		if s.Stat == nil {
+			return nil
+		}
+
+		stat := s.Stat(addr)
+		if stat == nil {
+			return nil
+		}
+
+		if len(payload) == 8 {
+			body = EncodeFullStat(stat)
+		} else {
+			body = EncodeBasicStat(stat)
+		}
+
+	default:
+		return nil
+	}
+
+	reply = make([]byte, 5, 5+len(body))
+	reply[0] = t
+	putUint32(reply[1:5], id)
+	return append(reply, body...)
+}
+
+// Returns the current and previous challenge tokens for addr, rotating the secrets they
+// are derived from if the rotation period has elapsed.
+func (s *Server) tokens(addr net.Addr) (current uint32, previous uint32) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	rotation := s.Rotation
+	if rotation <= 0 {
+		rotation = ChallengeRotation
+	}
+
+	now := time.Now()
+	periods := now.Sub(s.rotatedAt) / rotation
+
+	if s.rotatedAt.IsZero() || periods >= 2 {
+		rand.Read(s.secret[0][:])
+		rand.Read(s.secret[1][:])
+		s.rotatedAt = now
+
+	} else if periods == 1 {
+		s.secret[1] = s.secret[0]
+		rand.Read(s.secret[0][:])
+		s.rotatedAt = s.rotatedAt.Add(rotation)
+	}
+
+	key := addr.String()
+	return tokenFor(s.secret[0], key), tokenFor(s.secret[1], key)
+}
+
+// Derives a client's challenge token from a secret and its address, using FNV-1a.
+func tokenFor(secret [8]byte, addr string) (token uint32) {
+	h := uint64(14695981039346656037)
+
+	mix := func(b byte) {
+		h ^= uint64(b)
+		h *= 1099511628211
+	}
+
+	for _, b := range secret {
+		mix(b)
+	}
+
+	for i := 0; i < len(addr); i++ {
+		mix(addr[i])
+	}
+
+	return uint32(h) ^ uint32(h>>32)
+}
+
+// Builds the payload of a basic stat reply.
+func EncodeBasicStat(stat *Stat) (payload []byte) {
+	var b []byte
+
+	b = appendString(b, stat.MOTD)
+	b = appendString(b, stat.GameType)
+	b = appendString(b, stat.Map)
+	b = appendString(b, strconv.Itoa(stat.NumPlayers))
+	b = appendString(b, strconv.Itoa(stat.MaxPlayers))
+
+	port := make([]byte, 2)
+	binary.LittleEndian.PutUint16(port, uint16(stat.HostPort))
+	b = append(b, port...)
+
+	return appendString(b, stat.HostName)
+}
+
+// Builds the payload of a full stat reply. Keys in Extra are sent after the standard ones,
+// in sorted order.
+func EncodeFullStat(stat *Stat) (payload []byte) {
+	b := []byte("splitnum\x00\x80\x00")
+
+	plugins := stat.ServerMod
+	if len(stat.Plugins) > 0 {
+		plugins += ": " + strings.Join(stat.Plugins, "; ")
+	}
+
+	pairs := []string{
+		"hostname", stat.MOTD,
+		"gametype", stat.GameType,
+		"game_id", stat.GameID,
+		"version", stat.Version,
+		"plugins", plugins,
+		"map", stat.Map,
+		"numplayers", strconv.Itoa(stat.NumPlayers),
+		"maxplayers", strconv.Itoa(stat.MaxPlayers),
+		"hostport", strconv.Itoa(stat.HostPort),
+		"hostip", stat.HostName,
+	}
+
+	extraKeys := make([]string, 0, len(stat.Extra))
+	for key := range stat.Extra {
+		if key != "" {
+			extraKeys = append(extraKeys, key)
+		}
+	}
+
+	sort.Strings(extraKeys)
+
+	for _, key := range extraKeys {
+		pairs = append(pairs, key, stat.Extra[key])
+	}
+
+	for _, s := range pairs {
+		b = appendString(b, s)
+	}
+
+	b = append(b, 0)
+	b = append(b, fullStatPlayersMarker...)
+
+	for _, player := range stat.Players {
+		if player != "" {
+			b = appendString(b, player)
+		}
+	}
+
+	return append(b, 0)
+}
+
+// Appends s and a NUL terminator, dropping any NULs within s.
+func appendString(b []byte, s string) (result []byte) {
+	b = append(b, strings.Replace(s, "\x00", "", -1)...)
+	return append(b, 0)
+}
@@ -0,0 +1,298 @@
+package mcquery
+
+import (
+	"context"
+	"net"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+var testStat = &Stat{
+	MOTD:       "A Minecraft Server",
+	GameType:   "SMP",
+	GameID:     "MINECRAFT",
+	Version:    "1.3.2",
+	ServerMod:  "CraftBukkit on Bukkit 1.3.2-R1.0",
+	Map:        "world",
+	NumPlayers: 2,
+	MaxPlayers: 20,
+	HostPort:   25565,
+	HostName:   "127.0.0.1",
+	Plugins:    []string{"Essentials 2.9.2", "WorldEdit 5.4.2"},
+	Players:    []string{"barneygale", "Vivalahelvig"},
+	Extra:      map[string]string{"motd_plain": "A Minecraft Server"},
+}
+
+// A connection that counts the handshakes it receives.
+type countingConn struct {
+	net.PacketConn
+
+	mutex      sync.Mutex
+	handshakes int
+}
+
+func (conn *countingConn) ReadFrom(b []byte) (n int, addr net.Addr, err error) {
+	n, addr, err = conn.PacketConn.ReadFrom(b)
+	if n >= 3 && b[2] == 9 {
+		conn.mutex.Lock()
+		conn.handshakes++
+		conn.mutex.Unlock()
+	}
+
+	return n, addr, err
+}
+
+func (conn *countingConn) Handshakes() (n int) {
+	conn.mutex.Lock()
+	defer conn.mutex.Unlock()
+
+	return conn.handshakes
+}
+
+// Starts a server on a loopback port, returning its connection and a channel that
+// receives the result of Serve. The server is closed when the test ends.
+func startServer(t *testing.T, s *Server) (conn *countingConn, served chan error) {
+	inner, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conn = &countingConn{PacketConn: inner}
+	served = make(chan error, 1)
+
+	go func() {
+		served <- s.Serve(conn)
+	}()
+
+	t.Cleanup(func() {
+		s.Close()
+	})
+
+	return conn, served
+}
+
+// Dials a client with short timeouts for a test.
+func dialTest(t *testing.T, addr net.Addr) (c *Client) {
+	c, err := Dial(addr.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c.Timeout = 100 * time.Millisecond
+
+	t.Cleanup(func() {
+		c.Close()
+	})
+
+	return c
+}
+
+// Sends a raw request and returns the reply, or nil if none arrives in time.
+func rawRequest(t *testing.T, addr net.Addr, requestType byte, id uint32, payload []byte) (reply []byte) {
+	conn, err := net.Dial("udp", addr.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	message := make([]byte, 7, 7+len(payload))
+	message[0], message[1], message[2] = 0xFE, 0xFD, requestType
+	putUint32(message[3:7], id)
+
+	_, err = conn.Write(append(message, payload...))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conn.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+
+	buffer := make([]byte, 1500)
+	n, err := conn.Read(buffer)
+	if err != nil {
+		return nil
+	}
+
+	return buffer[:n]
+}
+
+func TestServerStats(t *testing.T) {
+	var mutex sync.Mutex
+	var from []net.Addr
+
+	s := &Server{Stat: func(addr net.Addr) *Stat {
+		mutex.Lock()
+		from = append(from, addr)
+		mutex.Unlock()
+
+		return testStat
+	}}
+
+	conn, _ := startServer(t, s)
+	c := dialTest(t, conn.LocalAddr())
+
+	err := c.Handshake(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	basic, err := c.BasicStat()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if basic.MOTD != testStat.MOTD || basic.GameType != testStat.GameType || basic.Map != testStat.Map ||
+		basic.NumPlayers != testStat.NumPlayers || basic.MaxPlayers != testStat.MaxPlayers ||
+		basic.HostPort != testStat.HostPort || basic.HostName != testStat.HostName {
+		t.Errorf("Basic stat: got %+v", basic)
+	}
+
+	full, err := c.FullStat()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(full, testStat) {
+		t.Errorf("Full stat: got %+v, expected %+v", full, testStat)
+	}
+
+	if n := conn.Handshakes(); n != 1 {
+		t.Errorf("Expected 1 handshake, got %d", n)
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	if len(from) != 2 || from[0].String() != c.conn.LocalAddr().String() {
+		t.Errorf("Stat called with %v, expected the client's address twice", from)
+	}
+}
+
+func TestServerDropsBadTokens(t *testing.T) {
+	rotation := 50 * time.Millisecond
+	s := &Server{Stat: func(net.Addr) *Stat { return testStat }, Rotation: rotation}
+	conn, _ := startServer(t, s)
+	addr := conn.LocalAddr()
+
+	if reply := rawRequest(t, addr, 0, 1, []byte{0, 0, 0, 0}); reply != nil {
+		t.Errorf("Unchallenged request was answered: %q", reply)
+	}
+
+	c := dialTest(t, addr)
+
+	err := c.Handshake(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Tokens are tied to the client's address, and each raw request comes from a new port.
+	if reply := rawRequest(t, addr, 0, 1, statRequest(c.challenge, false)); reply != nil {
+		t.Errorf("Request with another client's token was answered: %q", reply)
+	}
+
+	stale := c.challenge
+	time.Sleep(3 * rotation)
+
+	_, err = c.roundTrip(context.Background(), 0, statRequest(stale, false))
+	if err != ErrNoResponse {
+		t.Errorf("Request with a stale token: expected ErrNoResponse, got %v", err)
+	}
+}
+
+func TestClientRehandshakesAfterRotation(t *testing.T) {
+	rotation := 50 * time.Millisecond
+	s := &Server{Stat: func(net.Addr) *Stat { return testStat }, Rotation: rotation}
+	conn, _ := startServer(t, s)
+	c := dialTest(t, conn.LocalAddr())
+
+	_, err := c.FullStat()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	time.Sleep(3 * rotation)
+
+	_, err = c.FullStat()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if n := conn.Handshakes(); n != 2 {
+		t.Errorf("Expected 2 handshakes, got %d", n)
+	}
+}
+
+func TestClientCancelled(t *testing.T) {
+	// A port that never answers.
+	silent, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer silent.Close()
+
+	c, err := Dial(silent.LocalAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+
+	start := time.Now()
+	_, err = c.FullStatContext(ctx)
+	if err != context.Canceled {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Cancelled request took %s to return", elapsed)
+	}
+}
+
+func TestServerClose(t *testing.T) {
+	s := &Server{}
+	_, served := startServer(t, s)
+
+	// Let Serve start reading.
+	time.Sleep(50 * time.Millisecond)
+
+	err := s.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case err := <-served:
+		if err != nil {
+			t.Errorf("Serve returned %v after Close", err)
+		}
+
+	case <-time.After(time.Second):
+		t.Fatalf("Serve did not return after Close")
+	}
+}
+
+func TestServerCloseBeforeServe(t *testing.T) {
+	s := &Server{}
+	s.Close()
+
+	conn, served := startServer(t, s)
+
+	select {
+	case err := <-served:
+		if err != nil {
+			t.Errorf("Serve returned %v", err)
+		}
+
+	case <-time.After(time.Second):
+		t.Fatalf("Serve ran after Close")
+	}
+
+	// The connection is closed on return.
+	_, _, err := conn.ReadFrom(make([]byte, 1))
+	if err == nil {
+		t.Errorf("Connection is still open")
+	}
+}
@@ -0,0 +1,147 @@
+// Package nbt reads and writes Minecraft's Named Binary Tag format.
+//
+// Tags are represented by the following Go types:
+//
+//	TAG_Byte       int8
+//	TAG_Short      int16
+//	TAG_Int        int32
+//	TAG_Long       int64
+//	TAG_Float      float32
+//	TAG_Double     float64
+//	TAG_Byte_Array []byte
+//	TAG_String     string
+//	TAG_List       List
+//	TAG_Compound   Compound
+//	TAG_Int_Array  []int32
+package nbt
+
+import (
+	"fmt"
+)
+
+type TagType byte
+
+const (
+	TagEnd TagType = iota
+	TagByte
+	TagShort
+	TagInt
+	TagLong
+	TagFloat
+	TagDouble
+	TagByteArray
+	TagString
+	TagList
+	TagCompound
+	TagIntArray
+)
+
+var tagTypeNames = []string{
+	"TAG_End",
+	"TAG_Byte",
+	"TAG_Short",
+	"TAG_Int",
+	"TAG_Long",
+	"TAG_Float",
+	"TAG_Double",
+	"TAG_Byte_Array",
+	"TAG_String",
+	"TAG_List",
+	"TAG_Compound",
+	"TAG_Int_Array",
+}
+
+func (t TagType) String() (s string) {
+	if int(t) < len(tagTypeNames) {
+		return tagTypeNames[t]
+	}
+
+	return fmt.Sprintf("TAG_Unknown(%d)", byte(t))
+}
+
+// A compound tag: a set of named tags.
+type Compound map[string]interface{}
+
+// A list tag. All elements must be of type ElemType; an empty list should still specify
+// an element type (TagEnd is conventional when it is unknown).
+type List struct {
+	ElemType TagType
+	Elems    []interface{}
+}
+
+// Returns the tag type used to represent a Go value.
+func TypeOf(v interface{}) (t TagType, err error) {
+	switch v.(type) {
+	case int8:
+		return TagByte, nil
+	case int16:
+		return TagShort, nil
+	case int32:
+		return TagInt, nil
+	case int64:
+		return TagLong, nil
+	case float32:
+		return TagFloat, nil
+	case float64:
+		return TagDouble, nil
+	case []byte:
+		return TagByteArray, nil
+	case string:
+		return TagString, nil
+	case List:
+		return TagList, nil
+	case Compound:
+		return TagCompound, nil
+	case []int32:
+		return TagIntArray, nil
+	}
+
+	return TagEnd, fmt.Errorf("nbt: no tag type for Go type %T", v)
+}
+
+// Accessors that look up a tag by name and check its type.
+
+func (c Compound) Byte(name string) (v int8, ok bool) {
+	v, ok = c[name].(int8)
+	return v, ok
+}
+
+func (c Compound) Short(name string) (v int16, ok bool) {
+	v, ok = c[name].(int16)
+	return v, ok
+}
+
+func (c Compound) Int(name string) (v int32, ok bool) {
+	v, ok = c[name].(int32)
+	return v, ok
+}
+
+func (c Compound) Long(name string) (v int64, ok bool) {
+	v, ok = c[name].(int64)
+	return v, ok
+}
+
+func (c Compound) String(name string) (v string, ok bool) {
+	v, ok = c[name].(string)
+	return v, ok
+}
+
+func (c Compound) ByteArray(name string) (v []byte, ok bool) {
+	v, ok = c[name].([]byte)
+	return v, ok
+}
+
+func (c Compound) IntArray(name string) (v []int32, ok bool) {
+	v, ok = c[name].([]int32)
+	return v, ok
+}
+
+func (c Compound) List(name string) (v List, ok bool) {
+	v, ok = c[name].(List)
+	return v, ok
+}
+
+func (c Compound) Compound(name string) (v Compound, ok bool) {
+	v, ok = c[name].(Compound)
+	return v, ok
+}
@@ -0,0 +1,221 @@
+package nbt
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+)
+
+// Limits that protect against corrupt or hostile input.
+const (
+	MaxDepth       = 512      // The maximum nesting depth of lists and compounds.
+	MaxArrayLength = 16 << 20 // The maximum number of elements in an array or list.
+)
+
+var ErrTooDeep = errors.New("nbt: tags are nested too deeply")
+
+type reader struct {
+	r   *bufio.Reader
+	buf [8]byte
+}
+
+// Reads an uncompressed named compound tag from r.
+func Read(r io.Reader) (name string, root Compound, err error) {
+	nr := &reader{r: bufio.NewReader(r)}
+
+	t, err := nr.readByte()
+	if err != nil {
+		return "", nil, err
+	}
+
+	if TagType(t) != TagCompound {
+		return "", nil, fmt.Errorf("nbt: root tag is a %s, not a TAG_Compound", TagType(t))
+	}
+
+	name, err = nr.readString()
+	if err != nil {
+		return "", nil, unexpectedEOF(err)
+	}
+
+	v, err := nr.readPayload(TagCompound, 0)
+	if err != nil {
+		return "", nil, unexpectedEOF(err)
+	}
+
+	return name, v.(Compound), nil
+}
+
+// An EOF after the first byte means the data was truncated.
+func unexpectedEOF(err error) (result error) {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+
+	return err
+}
+
+func (nr *reader) readByte() (b byte, err error) {
+	return nr.r.ReadByte()
+}
+
+func (nr *reader) readUint16() (n uint16, err error) {
+	_, err = io.ReadFull(nr.r, nr.buf[:2])
+	return binary.BigEndian.Uint16(nr.buf[:2]), err
+}
+
+func (nr *reader) readUint32() (n uint32, err error) {
+	_, err = io.ReadFull(nr.r, nr.buf[:4])
+	return binary.BigEndian.Uint32(nr.buf[:4]), err
+}
+
+func (nr *reader) readUint64() (n uint64, err error) {
+	_, err = io.ReadFull(nr.r, nr.buf[:8])
+	return binary.BigEndian.Uint64(nr.buf[:8]), err
+}
+
+func (nr *reader) readString() (s string, err error) {
+	n, err := nr.readUint16()
+	if err != nil {
+		return "", err
+	}
+
+	b := make([]byte, n)
+	_, err = io.ReadFull(nr.r, b)
+	return string(b), err
+}
+
+func (nr *reader) readLength() (n int, err error) {
+	u, err := nr.readUint32()
+	if err != nil {
+		return 0, err
+	}
+
+	if int32(u) < 0 || u > MaxArrayLength {
+		return 0, fmt.Errorf("nbt: array length %d is out of range", int32(u))
+	}
+
+	return int(u), nil
+}
+
+func (nr *reader) readPayload(t TagType, depth int) (v interface{}, err error) {
+	if depth > MaxDepth {
+		return nil, ErrTooDeep
+	}
+
+	switch t {
+	case TagByte:
+		b, err := nr.readByte()
+		return int8(b), err
+
+	case TagShort:
+		n, err := nr.readUint16()
+		return int16(n), err
+
+	case TagInt:
+		n, err := nr.readUint32()
+		return int32(n), err
+
+	case TagLong:
+		n, err := nr.readUint64()
+		return int64(n), err
+
+	case TagFloat:
+		n, err := nr.readUint32()
+		return math.Float32frombits(n), err
+
+	case TagDouble:
+		n, err := nr.readUint64()
+		return math.Float64frombits(n), err
+
+	case TagByteArray:
+		n, err := nr.readLength()
+		if err != nil {
+			return nil, err
+		}
+
+		b := make([]byte, n)
+		_, err = io.ReadFull(nr.r, b)
+		return b, err
+
+	case TagString:
+		return nr.readString()
+
+	case TagList:
+		elemType, err := nr.readByte()
+		if err != nil {
+			return nil, err
+		}
+
+		n, err := nr.readLength()
+		if err != nil {
+			return nil, err
+		}
+
+		list := List{ElemType: TagType(elemType)}
+
+		if n > 0 {
+			if list.ElemType == TagEnd {
+				return nil, fmt.Errorf("nbt: non-empty list of TAG_End")
+			}
+
+			for i := 0; i < n; i++ {
+				elem, err := nr.readPayload(list.ElemType, depth+1)
+				if err != nil {
+					return nil, err
+				}
+
+				list.Elems = append(list.Elems, elem)
+			}
+		}
+
+		return list, nil
+
+	case TagCompound:
+		c := make(Compound)
+
+		for {
+			b, err := nr.readByte()
+			if err != nil {
+				return nil, err
+			}
+
+			elemType := TagType(b)
+			if elemType == TagEnd {
+				return c, nil
+			}
+
+			name, err := nr.readString()
+			if err != nil {
+				return nil, err
+			}
+
+			c[name], err = nr.readPayload(elemType, depth+1)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+	case TagIntArray:
+		n, err := nr.readLength()
+		if err != nil {
+			return nil, err
+		}
+
+		a := make([]int32, n)
+		for i := range a {
+			u, err := nr.readUint32()
+			if err != nil {
+				return nil, err
+			}
+
+			a[i] = int32(u)
+		}
+
+		return a, nil
+	}
+
+	return nil, fmt.Errorf("nbt: unknown tag type %d", byte(t))
+}
@@ -0,0 +1,182 @@
+package nbt
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+)
+
+type writer struct {
+	w   *bufio.Writer
+	buf [8]byte
+}
+
+// Writes a named compound tag to w, uncompressed. Keys of compounds are written in sorted
+// order so that the output is deterministic.
+func Write(w io.Writer, name string, root Compound) (err error) {
+	nw := &writer{w: bufio.NewWriter(w)}
+
+	err = nw.writeByte(byte(TagCompound))
+	if err != nil {
+		return err
+	}
+
+	err = nw.writeString(name)
+	if err != nil {
+		return err
+	}
+
+	err = nw.writePayload(root)
+	if err != nil {
+		return err
+	}
+
+	return nw.w.Flush()
+}
+
+func (nw *writer) writeByte(b byte) (err error) {
+	return nw.w.WriteByte(b)
+}
+
+func (nw *writer) writeUint16(n uint16) (err error) {
+	binary.BigEndian.PutUint16(nw.buf[:2], n)
+	_, err = nw.w.Write(nw.buf[:2])
+	return err
+}
+
+func (nw *writer) writeUint32(n uint32) (err error) {
+	binary.BigEndian.PutUint32(nw.buf[:4], n)
+	_, err = nw.w.Write(nw.buf[:4])
+	return err
+}
+
+func (nw *writer) writeUint64(n uint64) (err error) {
+	binary.BigEndian.PutUint64(nw.buf[:8], n)
+	_, err = nw.w.Write(nw.buf[:8])
+	return err
+}
+
+func (nw *writer) writeString(s string) (err error) {
+	if len(s) > math.MaxUint16 {
+		return fmt.Errorf("nbt: string of length %d is too long", len(s))
+	}
+
+	err = nw.writeUint16(uint16(len(s)))
+	if err != nil {
+		return err
+	}
+
+	_, err = nw.w.WriteString(s)
+	return err
+}
+
+func (nw *writer) writePayload(v interface{}) (err error) {
+	switch v := v.(type) {
+	case int8:
+		return nw.writeByte(byte(v))
+	case int16:
+		return nw.writeUint16(uint16(v))
+	case int32:
+		return nw.writeUint32(uint32(v))
+	case int64:
+		return nw.writeUint64(uint64(v))
+	case float32:
+		return nw.writeUint32(math.Float32bits(v))
+	case float64:
+		return nw.writeUint64(math.Float64bits(v))
+
+	case []byte:
+		err = nw.writeUint32(uint32(len(v)))
+		if err != nil {
+			return err
+		}
+
+		_, err = nw.w.Write(v)
+		return err
+
+	case string:
+		return nw.writeString(v)
+
+	case List:
+		err = nw.writeByte(byte(v.ElemType))
+		if err != nil {
+			return err
+		}
+
+		err = nw.writeUint32(uint32(len(v.Elems)))
+		if err != nil {
+			return err
+		}
+
+		for i, elem := range v.Elems {
+			t, err := TypeOf(elem)
+			if err != nil {
+				return err
+			}
+
+			if t != v.ElemType {
+				return fmt.Errorf("nbt: element %d of a list of %s is a %s", i, v.ElemType, t)
+			}
+
+			err = nw.writePayload(elem)
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+
+	case Compound:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			t, err := TypeOf(v[key])
+			if err != nil {
+				return err
+			}
+
+			err = nw.writeByte(byte(t))
+			if err != nil {
+				return err
+			}
+
+			err = nw.writeString(key)
+			if err != nil {
+				return err
+			}
+
+			err = nw.writePayload(v[key])
+			if err != nil {
+				return err
+			}
+		}
+
+		return nw.writeByte(byte(TagEnd))
+
+	case []int32:
+		err = nw.writeUint32(uint32(len(v)))
+		if err != nil {
+			return err
+		}
+
+		for _, n := range v {
+			err = nw.writeUint32(uint32(n))
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	_, err = TypeOf(v)
+	return err
+}
@@ -0,0 +1,64 @@
+package resources
+
+import (
+	"strings"
+)
+
+type Biome struct {
+	ID   byte   `json:"id"`   // The ID number of the biome, as stored in chunk data.
+	Name string `json:"name"` // The name of the biome, as shown on the debug screen.
+}
+
+var Biomes = []Biome{
+	Biome{0, "Ocean"},
+	Biome{1, "Plains"},
+	Biome{2, "Desert"},
+	Biome{3, "Extreme Hills"},
+	Biome{4, "Forest"},
+	Biome{5, "Taiga"},
+	Biome{6, "Swampland"},
+	Biome{7, "River"},
+	Biome{8, "Hell"},
+	Biome{9, "Sky"},
+	Biome{10, "FrozenOcean"},
+	Biome{11, "FrozenRiver"},
+	Biome{12, "Ice Plains"},
+	Biome{13, "Ice Mountains"},
+	Biome{14, "MushroomIsland"},
+	Biome{15, "MushroomIslandShore"},
+	Biome{16, "Beach"},
+	Biome{17, "DesertHills"},
+	Biome{18, "ForestHills"},
+	Biome{19, "TaigaHills"},
+	Biome{20, "Extreme Hills Edge"},
+	Biome{21, "Jungle"},
+	Biome{22, "JungleHills"},
+}
+
+func BiomeByID(id byte) (biome Biome, ok bool) {
+	for _, biome := range Biomes {
+		if biome.ID == id {
+			return biome, true
+		}
+	}
+
+	return Biome{}, false
+}
+
+// Returns the biome with the given name, ignoring case and spaces so that both
+// "Extreme Hills" and "extremehills" match.
+func BiomeByName(name string) (biome Biome, ok bool) {
+	name = normaliseBiomeName(name)
+
+	for _, biome := range Biomes {
+		if normaliseBiomeName(biome.Name) == name {
+			return biome, true
+		}
+	}
+
+	return Biome{}, false
+}
+
+func normaliseBiomeName(name string) (normalised string) {
+	return strings.ToLower(strings.Replace(name, " ", "", -1))
+}
@@ -0,0 +1,169 @@
+package resources
+
+import (
+	"math"
+	"strings"
+)
+
+// A set of block categories, used to check what sort of block an ID refers to without
+// comparing against ID numbers.
+type BlockCategory uint16
+
+const (
+	Solid       BlockCategory = 1 << iota // Players cannot walk through the block
+	Liquid                                // The block is water or lava, flowing or stationary
+	Water                                 // The block is flowing or stationary water
+	Lava                                  // The block is flowing or stationary lava
+	Log                                   // The block is a tree trunk
+	Leaves                                // The block is tree leaves
+	Ore                                   // The block is an ore
+	Plant                                 // The block is a plant or crop
+	Climbable                             // Players can climb the block
+	Falling                               // The block falls when nothing supports it
+	Replaceable                           // Placing a block into this one replaces it
+	Dangerous                             // Standing in or on the block hurts players
+	TileEntity                            // The block has a tile entity
+)
+
+var blockCategoryNames = []string{
+	"solid",
+	"liquid",
+	"water",
+	"lava",
+	"log",
+	"leaves",
+	"ore",
+	"plant",
+	"climbable",
+	"falling",
+	"replaceable",
+	"dangerous",
+	"tile_entity",
+}
+
+// The highest block ID in the tables below.
+const maxKnownBlockID = 145
+
+// Blocks with IDs up to maxKnownBlockID that players can walk through. Every other
+// known block is Solid.
+var nonSolidBlocks = []uint16{0, 6, 8, 9, 10, 11, 27, 28, 30, 31, 32, 37, 38, 39, 40, 50, 51, 55, 59, 63, 65, 66, 68, 69, 70, 72, 75, 76, 77, 78, 83, 90, 104, 105, 106, 115, 119, 131, 132, 141, 142, 143}
+
+var categoryBlocks = map[BlockCategory][]uint16{
+	Liquid:      []uint16{8, 9, 10, 11},
+	Water:       []uint16{8, 9},
+	Lava:        []uint16{10, 11},
+	Log:         []uint16{17},
+	Leaves:      []uint16{18},
+	Ore:         []uint16{14, 15, 16, 21, 56, 73, 74, 129},
+	Plant:       []uint16{6, 31, 32, 37, 38, 39, 40, 59, 81, 83, 104, 105, 106, 111, 115, 127, 141, 142},
+	Climbable:   []uint16{65, 106},
+	Falling:     []uint16{12, 13, 122, 145},
+	Replaceable: []uint16{0, 8, 9, 10, 11, 31, 32, 51, 78, 106},
+	Dangerous:   []uint16{10, 11, 51, 81},
+	TileEntity:  []uint16{23, 25, 36, 52, 54, 61, 62, 63, 68, 84, 116, 117, 119, 130, 137, 138, 144},
+}
+
+var blockCategories [4096]BlockCategory
+
+func init() {
+	for id := uint16(1); id <= maxKnownBlockID; id++ {
+		blockCategories[id] = Solid
+	}
+
+	for _, id := range nonSolidBlocks {
+		blockCategories[id] &^= Solid
+	}
+
+	for category, ids := range categoryBlocks {
+		for _, id := range ids {
+			blockCategories[id] |= category
+		}
+	}
+}
+
+// Returns the categories a block belongs to. Unknown blocks belong to none.
+func BlockCategories(id uint16) (categories BlockCategory) {
+	if int(id) >= len(blockCategories) {
+		return 0
+	}
+
+	return blockCategories[id]
+}
+
+// Reports whether a block belongs to any of the given categories.
+func BlockIs(id uint16, categories BlockCategory) (is bool) {
+	return BlockCategories(id)&categories != 0
+}
+
+// Returns the category with the given name, e.g. "log" or "leaves".
+func BlockCategoryByName(name string) (category BlockCategory, ok bool) {
+	name = strings.ToLower(name)
+
+	for i, categoryName := range blockCategoryNames {
+		if categoryName == name {
+			return 1 << uint(i), true
+		}
+	}
+
+	return 0, false
+}
+
+// Returns the names of the categories in the set, separated by commas.
+func (categories BlockCategory) String() (s string) {
+	var names []string
+
+	for i, name := range blockCategoryNames {
+		if categories&(1<<uint(i)) != 0 {
+			names = append(names, name)
+		}
+	}
+
+	return strings.Join(names, ",")
+}
+
+// The hardness of blocks with IDs up to maxKnownBlockID, which sets how long they take to
+// break. Blocks not listed break instantly; a negative hardness means the block cannot be
+// broken.
+var blockHardness = map[uint16]float64{
+	1: 1.5, 2: 0.6, 3: 0.5, 4: 2, 5: 2, 7: -1, 8: 100, 9: 100, 10: 100, 11: 100,
+	12: 0.5, 13: 0.6, 14: 3, 15: 3, 16: 3, 17: 2, 18: 0.2, 19: 0.6, 20: 0.3, 21: 3,
+	22: 3, 23: 3.5, 24: 0.8, 25: 0.8, 26: 0.2, 27: 0.7, 28: 0.7, 29: 0.5, 30: 4, 33: 0.5,
+	34: 0.5, 35: 0.8, 36: -1, 41: 3, 42: 5, 43: 2, 44: 2, 45: 2, 47: 1.5, 48: 2,
+	49: 50, 52: 5, 53: 2, 54: 2.5, 56: 3, 57: 5, 58: 2.5, 60: 0.6, 61: 3.5, 62: 3.5,
+	63: 1, 64: 3, 65: 0.4, 66: 0.7, 67: 2, 68: 1, 69: 0.5, 70: 0.5, 71: 5, 72: 0.5,
+	73: 3, 74: 3, 77: 0.5, 78: 0.1, 79: 0.5, 80: 0.2, 81: 0.4, 82: 0.6, 84: 2, 85: 2,
+	86: 1, 87: 0.4, 88: 0.5, 89: 0.3, 90: -1, 91: 1, 92: 0.5, 96: 3, 97: 0.75, 98: 1.5,
+	99: 0.2, 100: 0.2, 101: 5, 102: 0.3, 103: 1, 106: 0.2, 107: 2, 108: 2, 109: 1.5,
+	110: 0.6, 112: 2, 113: 2, 114: 2, 116: 5, 117: 0.5, 118: 2, 119: -1, 120: -1, 121: 3,
+	122: 3, 123: 0.3, 124: 0.3, 125: 2, 126: 2, 127: 0.2, 128: 0.8, 129: 3, 130: 22.5,
+	133: 5, 134: 2, 135: 2, 136: 2, 137: -1, 138: 3, 139: 2, 143: 0.5, 144: 1, 145: 5,
+}
+
+// Blocks that need a tool to be harvested, which take more than three times as long to
+// break without one.
+var toolBlocks = []uint16{1, 4, 14, 15, 16, 21, 22, 23, 24, 30, 41, 42, 43, 44, 45, 48, 49, 52, 56, 57, 61, 62, 67, 70, 71, 73, 74, 78, 80, 87, 98, 101, 108, 109, 112, 113, 114, 116, 117, 118, 121, 128, 129, 130, 133, 139, 145}
+
+// Returns how many ticks a player breaking a block with their hand, standing on the
+// ground, must keep digging before the server lets them finish. Blocks that break
+// instantly take 0 ticks. It returns false for blocks that cannot be broken or are not
+// known.
+func BlockBreakTicks(id uint16) (ticks int, ok bool) {
+	if id == 0 || id > maxKnownBlockID {
+		return 0, false
+	}
+
+	hardness := blockHardness[id]
+	if hardness < 0 {
+		return 0, false
+	}
+
+	perHardness := 30.0
+	for _, toolID := range toolBlocks {
+		if id == toolID {
+			perHardness = 100
+			break
+		}
+	}
+
+	return int(math.Ceil(hardness * perHardness)), true
+}